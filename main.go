@@ -9,6 +9,15 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := repl.RunFile(os.Args[1], os.Stderr); err != nil {
+			if err != repl.ErrScriptFailed {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
 	curUser, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,148 @@
+package monkey
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	evaluator "myMonkey/monkey_evaluator"
+	object "myMonkey/monkey_object"
+	"reflect"
+)
+
+// FromGo converts a Go value to a Monkey object:
+//
+//	nil                          null
+//	bool                         BOOLEAN
+//	signed and unsigned integers INTEGER, or BIGINT if it does not fit
+//	float32, float64             DECIMAL
+//	*big.Int, *big.Rat           BIGINT, RATIONAL
+//	string                       STRING
+//	slices and arrays            ARRAY
+//	maps                         HASH
+//	func(...object.Object) object.Object  BUILTIN
+//
+// An object.Object is returned unchanged. Elements of slices and maps are
+// converted in turn.
+func FromGo(value interface{}) (object.Object, error) {
+	switch v := value.(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case object.Object:
+		return v, nil
+	case bool:
+		if v {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case string:
+		return &object.String{Value: v}, nil
+	case *big.Int:
+		return &object.BigInt{Value: new(big.Int).Set(v)}, nil
+	case *big.Rat:
+		return &object.Rational{Value: new(big.Rat).Set(v)}, nil
+	case func(...object.Object) object.Object:
+		return &object.Builtin{Fn: v}, nil
+	case object.BuiltinFn:
+		return &object.Builtin{Fn: v}, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return &object.BigInt{Value: new(big.Int).SetUint64(u)}, nil
+		}
+		return &object.Integer{Value: int64(u)}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Decimal{Value: rv.Float()}, nil
+	case reflect.Slice, reflect.Array:
+		elems := make([]object.Object, rv.Len())
+		for i := range elems {
+			elem, err := FromGo(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return &object.Array{Value: elems}, nil
+	case reflect.Map:
+		pairs := make(map[object.HashKey]object.HashPair, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := FromGo(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := key.(object.HashAble)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			val, err := FromGo(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to a Monkey value", value)
+}
+
+// ToGo converts a Monkey object to a Go value, the reverse of FromGo: INTEGER
+// becomes int64, DECIMAL float64, BIGINT *big.Int, RATIONAL *big.Rat, ARRAY
+// []interface{} and HASH map[interface{}]interface{}, where BIGINT and
+// RATIONAL keys become a BigKey. Functions and other objects without a Go
+// counterpart are returned unchanged.
+func ToGo(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+	case *object.Boolean:
+		return obj.Value
+	case *object.Integer:
+		return obj.Value
+	case *object.BigInt:
+		return new(big.Int).Set(obj.Value)
+	case *object.Rational:
+		return new(big.Rat).Set(obj.Value)
+	case *object.Decimal:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Array:
+		elems := make([]interface{}, len(obj.Value))
+		for i, elem := range obj.Value {
+			elems[i] = ToGo(elem)
+		}
+		return elems
+	case *object.Hash:
+		m := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			m[hashableGo(pair.Key)] = ToGo(pair.Value)
+		}
+		return m
+	default:
+		return obj
+	}
+}
+
+// BigKey is the Go map key ToGo uses for a BIGINT or RATIONAL hash key, since
+// pointers to big numbers would never compare equal. Text is the number as
+// Monkey prints it, such as "1/3".
+type BigKey struct {
+	Type object.ObjectType
+	Text string
+}
+
+// hashableGo converts a hash key for use as a Go map key.
+func hashableGo(key object.Object) interface{} {
+	switch key := key.(type) {
+	case *object.BigInt, *object.Rational:
+		return BigKey{Type: key.Type(), Text: key.Inspect()}
+	default:
+		return ToGo(key)
+	}
+}
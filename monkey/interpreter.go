@@ -0,0 +1,144 @@
+// Package monkey embeds the Monkey interpreter in Go programs. An Interpreter
+// keeps its global variables between runs, so a host can load a script once
+// and then call the functions it defines.
+package monkey
+
+import (
+	"fmt"
+	evaluator "myMonkey/monkey_evaluator"
+	lexer "myMonkey/monkey_lexer"
+	object "myMonkey/monkey_object"
+	parser "myMonkey/monkey_parser"
+	token "myMonkey/monkey_token"
+	"os"
+)
+
+// Interpreter runs Monkey code in its own global environment. It is not safe
+// for concurrent use.
+type Interpreter struct {
+	// Limits applies to every Run, RunFile and Call; the zero value means no
+	// limits.
+	Limits evaluator.Options
+
+	env *object.Environment
+}
+
+func NewInterpreter() *Interpreter {
+	return &Interpreter{env: object.NewEnvironment()}
+}
+
+// ParseError is returned when the source has syntax errors. Errors holds all
+// of them, in the order they were found.
+type ParseError struct {
+	Errors []*parser.ParseError
+}
+
+func (e *ParseError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e.Errors[0], len(e.Errors)-1)
+}
+
+// RuntimeError is returned when evaluation fails, including when an error
+// thrown by the script is not caught.
+type RuntimeError struct {
+	Kind    string
+	Message string
+	Pos     token.Position
+	Trace   []object.Frame
+	// Err is the error object the script produced.
+	Err *object.Error
+}
+
+func newRuntimeError(err *object.Error) *RuntimeError {
+	return &RuntimeError{Kind: err.KindName(), Message: err.Message, Pos: err.Pos, Trace: err.Trace, Err: err}
+}
+
+func (e *RuntimeError) Error() string {
+	if !e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Pos, e.Kind, e.Message)
+}
+
+// Traceback formats the error and the calls that led to it as the REPL shows
+// them.
+func (e *RuntimeError) Traceback() string {
+	return e.Err.Traceback()
+}
+
+// Run evaluates src and returns the value of its last statement, converted
+// with ToGo.
+func (in *Interpreter) Run(src string) (interface{}, error) {
+	return in.run(lexer.NewLexer(src))
+}
+
+// RunFile is Run for the script at path; positions in errors name the file.
+func (in *Interpreter) RunFile(path string) (interface{}, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return in.run(lexer.NewFileLexer(path, string(src)))
+}
+
+func (in *Interpreter) run(l *lexer.Lexer) (interface{}, error) {
+	p := parser.NewParser(l)
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	return in.result(evaluator.EvalWithOptions(program, in.env, in.Limits))
+}
+
+// Call calls the global function name with args, each converted with FromGo,
+// and returns its result converted with ToGo.
+func (in *Interpreter) Call(name string, args ...interface{}) (interface{}, error) {
+	fn, ok := in.env.Get(name)
+	if !ok {
+		return nil, newRuntimeError(&object.Error{Message: "identifier not found: " + name, Kind: object.NAME_ERROR})
+	}
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := FromGo(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d to %s: %v", i, name, err)
+		}
+		objs[i] = obj
+	}
+	return in.result(evaluator.ApplyWithOptions(fn, objs, in.env, in.Limits))
+}
+
+func (in *Interpreter) result(obj object.Object) (interface{}, error) {
+	if err, ok := obj.(*object.Error); ok {
+		return nil, newRuntimeError(err)
+	}
+	return ToGo(obj), nil
+}
+
+// Set defines the global name as value, converted with FromGo. A Go function
+// of type func(...object.Object) object.Object becomes a builtin.
+func (in *Interpreter) Set(name string, value interface{}) error {
+	obj, err := FromGo(value)
+	if err != nil {
+		return fmt.Errorf("set %s: %v", name, err)
+	}
+	if builtin, ok := obj.(*object.Builtin); ok && builtin.Name == "" {
+		// name a copy for tracebacks; the host may set the same builtin twice
+		named := *builtin
+		named.Name = name
+		obj = &named
+	}
+	in.env.Set(name, obj)
+	return nil
+}
+
+// Get returns the global name converted with ToGo, and whether it is defined.
+func (in *Interpreter) Get(name string) (interface{}, bool) {
+	obj, ok := in.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return ToGo(obj), true
+}
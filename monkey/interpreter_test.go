@@ -0,0 +1,181 @@
+package monkey
+
+import (
+	"errors"
+	"math/big"
+	object "myMonkey/monkey_object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2", 3.0},
+		{`"mon" + "key"`, "monkey"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"def a = 1;", nil},
+		{"[1, [true, \"x\"]]", []interface{}{int64(1), []interface{}{true, "x"}}},
+		{`{"a": 1, 2: [], true: "t"}`, map[interface{}]interface{}{"a": int64(1), int64(2): []interface{}{}, true: "t"}},
+		{"bigint(2) ** 70", new(big.Int).Lsh(big.NewInt(1), 70)},
+		{"rational(1, 3)", big.NewRat(1, 3)},
+		{`{bigint(10) ** 30: 1, "1000000000000000000000000000000": 2, rational(1, 3): 3}`, map[interface{}]interface{}{
+			BigKey{Type: object.BIGINT_OBJ, Text: "1000000000000000000000000000000"}: int64(1),
+			"1000000000000000000000000000000":                                        int64(2),
+			BigKey{Type: object.RATIONAL_OBJ, Text: "1/3"}:                           int64(3),
+		}},
+	}
+	for _, test := range tests {
+		got, err := NewInterpreter().Run(test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: got=%#v, want=%#v", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestGlobalsAndCall(t *testing.T) {
+	in := NewInterpreter()
+	if _, err := in.Run("def total = 0; def add = func(n) { total += n; ret total };"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, n := range []int{1, 2, 3} {
+		if _, err := in.Call("add", n); err != nil {
+			t.Fatalf("add(%d): unexpected error: %v", n, err)
+		}
+	}
+	if total, ok := in.Get("total"); !ok || total != int64(6) {
+		t.Errorf("total: got=%#v (%t), want 6", total, ok)
+	}
+	if _, ok := in.Get("missing"); ok {
+		t.Errorf("missing global reported as defined")
+	}
+
+	if err := in.Set("config", map[string]interface{}{"name": "svc", "ports": []int{80, 443}, "ratio": float32(0.5)}); err != nil {
+		t.Fatalf("set: unexpected error: %v", err)
+	}
+	got, err := in.Run(`[config["name"], config["ports"][1], config["ratio"]]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []interface{}{"svc", int64(443), 0.5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got=%#v, want=%#v", got, want)
+	}
+
+	double := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}
+	if err := in.Set("double", double); err != nil {
+		t.Fatalf("set: unexpected error: %v", err)
+	}
+	if got, err := in.Run("[1, 2] |> map(double)"); err != nil || !reflect.DeepEqual(got, []interface{}{int64(2), int64(4)}) {
+		t.Errorf("calling a Go builtin: got=%#v, %v", got, err)
+	}
+
+	_, err = in.Run(`double("x")`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || !strings.HasPrefix(err.Error(), "1:7: Error: double panicked: ") {
+		t.Errorf("wrong error for a panicking builtin: %v", err)
+	}
+	if _, err := in.Call("double"); !errors.As(err, &runtimeErr) {
+		t.Errorf("wrong error for a panicking builtin: %v", err)
+	}
+
+	shared := &object.Builtin{Fn: double}
+	in.Set("twice", shared)
+	in.Set("dbl", shared)
+	for _, name := range []string{"twice", "dbl"} {
+		if b, _ := in.Get(name); b.(*object.Builtin).Name != name {
+			t.Errorf("builtin set as %s is named %q", name, b.(*object.Builtin).Name)
+		}
+	}
+	if shared.Name != "" {
+		t.Errorf("Set renamed the host's builtin to %q", shared.Name)
+	}
+
+	if err := in.Set("ch", make(chan int)); err == nil || err.Error() != "set ch: cannot convert chan int to a Monkey value" {
+		t.Errorf("wrong error for unconvertible value: %v", err)
+	}
+	if _, err := in.Call("add", struct{}{}); err == nil {
+		t.Errorf("unconvertible argument accepted")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	in := NewInterpreter()
+
+	_, err := in.Run("def = 1; def x = ;")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("no ParseError returned. got=%T (%v)", err, err)
+	}
+	if len(parseErr.Errors) < 2 || parseErr.Error() != parseErr.Errors[0].Error()+" (and "+strconv.Itoa(len(parseErr.Errors)-1)+" more errors)" {
+		t.Errorf("wrong parse error: %v (%d errors)", parseErr, len(parseErr.Errors))
+	}
+
+	_, err = in.Run("def f = func(n) { ret n / 0 };\nf(1)")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("no RuntimeError returned. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Kind != object.ARITHMETIC_ERROR || runtimeErr.Message != "division by zero: 1 / 0" || len(runtimeErr.Trace) != 1 {
+		t.Errorf("wrong runtime error: %+v", runtimeErr)
+	}
+	if err.Error() != "1:25: ArithmeticError: division by zero: 1 / 0" {
+		t.Errorf("wrong message: %q", err.Error())
+	}
+
+	_, err = in.Call("f", 2)
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.ARITHMETIC_ERROR {
+		t.Errorf("wrong error from Call: %v", err)
+	}
+	_, err = in.Call("g")
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.NAME_ERROR || err.Error() != "NameError: identifier not found: g" {
+		t.Errorf("wrong error for calling an undefined function: %v", err)
+	}
+	_, err = in.Run(`throw({"code": 7}, "AppError")`)
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != "AppError" || runtimeErr.Err.Value.Inspect() != "{code: 7}" {
+		t.Errorf("wrong error for a thrown value: %v", err)
+	}
+
+	in.Limits.MaxSteps = 1000
+	_, err = in.Run("while (true) {}")
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.LIMIT_ERROR {
+		t.Errorf("limit not applied to Run: %v", err)
+	}
+	in.Run("def spin = func() { while (true) {} };")
+	_, err = in.Call("spin")
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.LIMIT_ERROR {
+		t.Errorf("limit not applied to Call: %v", err)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte("def greet = func(name) { ret \"hello \" + name };\ngreet(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	in := NewInterpreter()
+	_, err := in.RunFile(path)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Pos.File != path {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if got, err := in.Call("greet", "gopher"); err != nil || got != "hello gopher" {
+		t.Errorf("greet: got=%#v, %v", got, err)
+	}
+	if _, err := in.RunFile(filepath.Join(t.TempDir(), "missing.mk")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wrong error for a missing file: %v", err)
+	}
+}
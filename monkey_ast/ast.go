@@ -2,6 +2,7 @@ package monkey_ast
 
 import (
 	"bytes"
+	"math/big"
 	token "myMonkey/monkey_token"
 	"strings"
 )
@@ -9,6 +10,7 @@ import (
 type Node interface {
 	String() string
 	TokenLiteral() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -33,6 +35,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -49,27 +58,35 @@ type Identifier struct {
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
-func (i *Identifier) expressionNode() {}
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) expressionNode()     {}
+func (i *Identifier) patternNode()        {}
 
 func (i *Identifier) String() string {
 	return i.Value
 }
 
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern // set instead of Name by a destructuring def
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
 
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	if ls.Value != nil {
 		out.WriteString(" = ")
 		out.WriteString(ls.Value.String())
@@ -79,21 +96,99 @@ func (ls *LetStatement) String() string {
 }
 
 type AssignExpression struct {
-	Token token.Token //should be =
-	Name  *Identifier
-	Value Expression
+	Token  token.Token // = or a compound operator such as +=
+	Target Expression  // an *Identifier or an *IndexExpression
+	Value  Expression
+}
+
+// Operator returns the infix operator applied by a compound assignment, e.g.
+// "+" for +=, and "" for a plain =.
+func (ae *AssignExpression) Operator() string {
+	return strings.TrimSuffix(ae.Token.Literal, "=")
 }
 
 func (ae *AssignExpression) expressionNode()      {}
 func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
 func (ae *AssignExpression) String() string {
 	var out bytes.Buffer
-	out.WriteString(ae.Name.String() + " ")
+	out.WriteString(ae.Target.String() + " ")
 	out.WriteString(ae.TokenLiteral() + " ")
 	out.WriteString(ae.Value.String())
 	return out.String()
 }
 
+// Pattern is the left-hand side of a def: an *Identifier, an *ArrayPattern or
+// a *HashPattern.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// PatternElement is one destructured position, with an optional default used
+// when the value is missing.
+type PatternElement struct {
+	Target  Pattern
+	Default Expression
+}
+
+func (pe *PatternElement) String() string {
+	if pe.Default != nil {
+		return pe.Target.String() + " = " + pe.Default.String()
+	}
+	return pe.Target.String()
+}
+
+// ArrayPattern is `[a, b = 1, ...rest]`.
+type ArrayPattern struct {
+	Token    token.Token // the [ token
+	Elements []*PatternElement
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos }
+func (ap *ArrayPattern) String() string {
+	elems := []string{}
+	for _, e := range ap.Elements {
+		elems = append(elems, e.String())
+	}
+	if ap.Rest != nil {
+		elems = append(elems, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// HashPatternEntry binds the value stored under Key, e.g. `age: years = 0`.
+// The shorthand `name` has an Identifier target named after the key.
+type HashPatternEntry struct {
+	Token token.Token
+	Key   string
+	Value *PatternElement
+}
+
+// HashPattern is `{name, age: years}`.
+type HashPattern struct {
+	Token   token.Token // the { token
+	Entries []*HashPatternEntry
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos }
+func (hp *HashPattern) String() string {
+	entries := []string{}
+	for _, e := range hp.Entries {
+		if ident, ok := e.Value.Target.(*Identifier); ok && ident.Value == e.Key {
+			entries = append(entries, e.Value.String())
+		} else {
+			entries = append(entries, e.Key+": "+e.Value.String())
+		}
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
@@ -101,6 +196,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -118,6 +214,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -125,6 +222,26 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
+type IntegerLiteral struct {
+	Token token.Token
+	Value int64
+}
+
+func (il *IntegerLiteral) expressionNode()      {}
+func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+func (il *IntegerLiteral) String() string       { return il.TokenLiteral() }
+
+type BigIntLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (bl *BigIntLiteral) expressionNode()      {}
+func (bl *BigIntLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BigIntLiteral) Pos() token.Position  { return bl.Token.Pos }
+func (bl *BigIntLiteral) String() string       { return bl.TokenLiteral() }
+
 type DecimalLiteral struct {
 	Token token.Token
 	Value float64
@@ -132,6 +249,7 @@ type DecimalLiteral struct {
 
 func (dl *DecimalLiteral) expressionNode()      {}
 func (dl *DecimalLiteral) TokenLiteral() string { return dl.Token.Literal }
+func (dl *DecimalLiteral) Pos() token.Position  { return dl.Token.Pos }
 func (dl *DecimalLiteral) String() string       { return dl.TokenLiteral() }
 
 type PrefixExpression struct {
@@ -142,6 +260,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -151,6 +270,21 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// PostfixExpression is x++ or x--, which update x and yield its old value. As
+// with assignments, x may also be an index expression.
+type PostfixExpression struct {
+	Token    token.Token
+	Left     Expression
+	Operator string
+}
+
+func (pe *PostfixExpression) expressionNode()      {}
+func (pe *PostfixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PostfixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PostfixExpression) String() string {
+	return "(" + pe.Left.String() + pe.Operator + ")"
+}
+
 type InfixExpression struct {
 	Token    token.Token
 	Left     Expression
@@ -160,6 +294,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -170,6 +305,28 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// LogicalExpression is a short-circuiting binary operator (&&, || or ??): the
+// right operand is only evaluated when the left one does not decide the result.
+type LogicalExpression struct {
+	Token    token.Token
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+func (le *LogicalExpression) expressionNode()      {}
+func (le *LogicalExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LogicalExpression) Pos() token.Position  { return le.Token.Pos }
+func (le *LogicalExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(le.Left.String())
+	out.WriteString(" " + le.Operator + " ")
+	out.WriteString(le.Right.String())
+	out.WriteString(")")
+	return out.String()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -177,6 +334,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.TokenLiteral() }
 
 type BlockStatement struct {
@@ -186,6 +344,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("{")
@@ -201,38 +360,161 @@ type ConditionExpression struct {
 	Condition Expression
 	True      *BlockStatement
 	False     *BlockStatement
+	ElseIf    *ConditionExpression // set instead of False for `else if`
 }
 
 func (ce *ConditionExpression) expressionNode()      {}
 func (ce *ConditionExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ConditionExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *ConditionExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
 	out.WriteString(ce.Condition.String())
 	out.WriteString(" ")
 	out.WriteString(ce.True.String())
-	if ce.False != nil {
+	if ce.ElseIf != nil {
+		out.WriteString("else " + ce.ElseIf.String())
+	} else if ce.False != nil {
 		out.WriteString("else " + ce.False.String())
 	}
 	return out.String()
 }
 
+// TryExpression is `try { } catch (e) { } finally { }`, where either the catch
+// or the finally clause may be left out, as may the catch parameter.
+type TryExpression struct {
+	Token   token.Token
+	Block   *BlockStatement
+	Param   *Identifier
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try " + te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.Param != nil {
+			out.WriteString("(" + te.Param.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally " + te.Finally.String())
+	}
+	return out.String()
+}
+
+// TernaryExpression is `cond ? a : b`.
+type TernaryExpression struct {
+	Token       token.Token // the ? token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (te *TernaryExpression) expressionNode()      {}
+func (te *TernaryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TernaryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TernaryExpression) String() string {
+	return "(" + te.Condition.String() + " ? " + te.Consequence.String() + " : " + te.Alternative.String() + ")"
+}
+
+// MatchExpression compares Value against the patterns of its arms in order
+// and evaluates the body of the first arm that matches.
+type MatchExpression struct {
+	Token token.Token
+	Value Expression
+	Arms  []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	return "match(" + me.Value.String() + ") {" + strings.Join(arms, ", ") + "}"
+}
+
+// MatchArm is `pattern [if guard] => body`. The pattern `_` matches anything,
+// other identifiers match anything and bind the value, array and hash
+// literals destructure, and any other expression is compared for equality.
+// To compare against the value of a variable rather than bind it, pin the
+// variable: `^name`.
+type MatchArm struct {
+	Token   token.Token
+	Pattern Expression
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" => " + ma.Body.String())
+	return out.String()
+}
+
+// PinExpression is `^name` in a match pattern. It matches a value equal to
+// that of the variable name instead of binding name.
+type PinExpression struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (pe *PinExpression) expressionNode()      {}
+func (pe *PinExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PinExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PinExpression) String() string       { return "^" + pe.Name.String() }
+
 type FunctionLiteral struct {
 	Token      token.Token
+	Name       string // set when the function is bound by def, for stack traces
 	Parameters []*Identifier
+	Defaults   []Expression // parallel to Parameters, nil where there is no default
+	Rest       *Identifier  // the ...rest parameter, if any
 	Body       *BlockStatement
 }
 
+// ParamList formats a parameter list the way it is written in source.
+func ParamList(params []*Identifier, defaults []Expression, rest *Identifier) string {
+	list := []string{}
+	for i, p := range params {
+		if i < len(defaults) && defaults[i] != nil {
+			list = append(list, p.String()+" = "+defaults[i].String())
+		} else {
+			list = append(list, p.String())
+		}
+	}
+	if rest != nil {
+		list = append(list, "..."+rest.String())
+	}
+	return strings.Join(list, ", ")
+}
+
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	if fl.Token.Type == token.LPAREN {
+		// an arrow function
+		out.WriteString("(" + ParamList(fl.Parameters, fl.Defaults, fl.Rest) + ") => ")
+		out.WriteString(fl.Body.String())
+		return out.String()
 	}
 	out.WriteString(fl.TokenLiteral() + "(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ParamList(fl.Parameters, fl.Defaults, fl.Rest))
 	out.WriteString(") " + fl.Body.String())
 	return out.String()
 }
@@ -245,6 +527,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -266,6 +549,7 @@ type LoopStatement struct {
 
 func (ls *LoopStatement) statementNode()       {}
 func (ls *LoopStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LoopStatement) Pos() token.Position  { return ls.Token.Pos }
 func (ls *LoopStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + "(")
@@ -283,6 +567,24 @@ func (ls *LoopStatement) String() string {
 	return out.String()
 }
 
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) String() string       { return bs.TokenLiteral() + ";" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string       { return cs.TokenLiteral() + ";" }
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -290,6 +592,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 type ArrayLiteral struct {
@@ -299,6 +602,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("[")
@@ -315,14 +619,19 @@ type IndexExpression struct {
 	Token token.Token
 	Left  Expression
 	Index Expression
+	Safe  bool // written ?.[, yields null instead of failing on a null Left
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Safe {
+		out.WriteString("?.")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
@@ -332,15 +641,17 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression // the keys of Pairs in source order
 }
 
 func (*HashLiteral) expressionNode()         {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+": "+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ","))
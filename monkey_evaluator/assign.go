@@ -0,0 +1,162 @@
+package monkey_evaluator
+
+import (
+	ast "myMonkey/monkey_ast"
+	object "myMonkey/monkey_object"
+)
+
+// reference is a location that can be assigned to: either a variable, held
+// by the scope that defines it, or an element of an array or a hash.
+type reference struct {
+	env       *object.Environment
+	name      string
+	container object.Object
+	index     object.Object
+}
+
+func isTarget(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return true
+	}
+	return false
+}
+
+// resolveReference evaluates everything in target except the final read, so
+// that a[f()] += 1 calls f only once.
+func resolveReference(target ast.Expression, env *object.Environment) (*reference, object.Object) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		scope := env.Resolve(target.Value)
+		if scope == nil {
+			return nil, newKindError(object.NAME_ERROR, "identifier not found: %s", target.Value)
+		}
+		return &reference{env: scope, name: target.Value}, nil
+	case *ast.IndexExpression:
+		container := Eval(target.Left, env)
+		if isAbrupt(container) {
+			return nil, container
+		}
+		index := Eval(target.Index, env)
+		if isAbrupt(index) {
+			return nil, index
+		}
+		return &reference{container: container, index: index}, nil
+	default:
+		return nil, newKindError(object.TYPE_ERROR, "cannot assign to %s", target.String())
+	}
+}
+
+// get reads the current value for a compound assignment or ++/--. Unlike a
+// plain index expression, reading past the end of an array is an error.
+func (r *reference) get() object.Object {
+	switch container := r.container.(type) {
+	case nil:
+		val, _ := r.env.Get(r.name)
+		return val
+	case *object.Array:
+		i, err := arrayOffset(container, r.index)
+		if err != nil {
+			return err
+		}
+		return container.Value[i]
+	default:
+		return evalIndex(r.container, r.index)
+	}
+}
+
+// arrayOffset checks that index addresses an element of array, counting
+// negative indexes from the end, and returns its offset.
+func arrayOffset(array *object.Array, index object.Object) (int64, object.Object) {
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return 0, newKindError(object.TYPE_ERROR, "array index must be %s, got %s", object.INTEGER_OBJ, index.Type())
+	}
+	i := idx.Value
+	if i < 0 {
+		i += int64(len(array.Value))
+	}
+	if i < 0 || i >= int64(len(array.Value)) {
+		return 0, newKindError(object.INDEX_ERROR, "index out of range: %d (length %d)", idx.Value, len(array.Value))
+	}
+	return i, nil
+}
+
+// set stores val, mutating arrays and hashes in place. It returns an error
+// object or nil.
+func (r *reference) set(val object.Object) object.Object {
+	switch container := r.container.(type) {
+	case nil:
+		r.env.Set(r.name, val)
+	case *object.Array:
+		i, err := arrayOffset(container, r.index)
+		if err != nil {
+			return err
+		}
+		container.Value[i] = val
+	case *object.Hash:
+		key, ok := r.index.(object.HashAble)
+		if !ok {
+			return newKindError(object.TYPE_ERROR, "unusable as hash key: %s", r.index.Type())
+		}
+		container.Pairs[key.HashKey()] = object.HashPair{Key: r.index, Value: val}
+	default:
+		return newKindError(object.TYPE_ERROR, "index assignment not supported: %s", r.container.Type())
+	}
+	return nil
+}
+
+// evalAssign handles = and the compound assignments such as +=.
+func evalAssign(node *ast.AssignExpression, env *object.Environment) object.Object {
+	ref, err := resolveReference(node.Target, env)
+	if err != nil {
+		return err
+	}
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	if op := node.Operator(); op != "" {
+		old := ref.get()
+		if isError(old) {
+			return old
+		}
+		if err := chargeAlloc(env.Budget(), infixSize(op, old, val)); err != nil {
+			return err
+		}
+		val = evalInfix(op, old, val)
+		if isError(val) {
+			return val
+		}
+	}
+	return ref.set(val)
+}
+
+// evalBump implements ++ and -- on a variable or an element. The new value is
+// written back; the prefix form yields it, the postfix form the old value.
+func evalBump(op string, target ast.Expression, postfix bool, env *object.Environment) object.Object {
+	ref, err := resolveReference(target, env)
+	if err != nil {
+		return err
+	}
+	old := ref.get()
+	if isError(old) {
+		return old
+	}
+	var val object.Object
+	if op == "++" {
+		val = evalBumpPlus(old)
+	} else {
+		val = evalBumpMinus(old)
+	}
+	if isError(val) {
+		return val
+	}
+	if err := ref.set(val); err != nil {
+		return err
+	}
+	if postfix {
+		return old
+	}
+	return val
+}
@@ -0,0 +1,86 @@
+package monkey_evaluator
+
+import (
+	ast "myMonkey/monkey_ast"
+	object "myMonkey/monkey_object"
+)
+
+// bindPattern defines the variables of a destructuring def in env. It returns
+// an error object when value does not have the shape the pattern asks for,
+// and nil otherwise. The variable _ is never bound.
+func bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			env.Set(pattern.Value, value)
+		}
+		return nil
+	case *ast.ArrayPattern:
+		return bindArrayPattern(pattern, value, env)
+	case *ast.HashPattern:
+		return bindHashPattern(pattern, value, env)
+	default:
+		return newKindError(object.TYPE_ERROR, "unsupported pattern: %s", pattern.String())
+	}
+}
+
+func bindArrayPattern(pattern *ast.ArrayPattern, value object.Object, env *object.Environment) object.Object {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return newKindError(object.TYPE_ERROR, "cannot destructure %s as an array: %s", value.Type(), pattern.String())
+	}
+	if pattern.Rest == nil && len(array.Value) > len(pattern.Elements) {
+		return newKindError(object.INDEX_ERROR, "too many elements to destructure: got %d, want %d", len(array.Value), len(pattern.Elements))
+	}
+	for i, elem := range pattern.Elements {
+		var val object.Object
+		if i < len(array.Value) {
+			val = array.Value[i]
+		} else if elem.Default == nil {
+			return newKindError(object.INDEX_ERROR, "not enough elements to destructure: got %d, want %d", len(array.Value), len(pattern.Elements))
+		}
+		if err := bindElement(elem, val, env); err != nil {
+			return err
+		}
+	}
+	if pattern.Rest != nil {
+		rest := []object.Object{}
+		if len(array.Value) > len(pattern.Elements) {
+			rest = append(rest, array.Value[len(pattern.Elements):]...)
+		}
+		env.Set(pattern.Rest.Value, &object.Array{Value: rest})
+	}
+	return nil
+}
+
+func bindHashPattern(pattern *ast.HashPattern, value object.Object, env *object.Environment) object.Object {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return newKindError(object.TYPE_ERROR, "cannot destructure %s as a hash: %s", value.Type(), pattern.String())
+	}
+	for _, entry := range pattern.Entries {
+		key := &object.String{Value: entry.Key}
+		var val object.Object
+		if pair, ok := hash.Pairs[key.HashKey()]; ok {
+			val = pair.Value
+		} else if entry.Value.Default == nil {
+			return newKindError(object.KEY_ERROR, "missing key %q to destructure", entry.Key)
+		}
+		if err := bindElement(entry.Value, val, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindElement binds val, or the element's default if val is nil. Defaults are
+// evaluated in env, so they can refer to variables bound before them.
+func bindElement(elem *ast.PatternElement, val object.Object, env *object.Environment) object.Object {
+	if val == nil {
+		val = Eval(elem.Default, env)
+		if isAbrupt(val) {
+			return val
+		}
+	}
+	return bindPattern(elem.Target, val, env)
+}
@@ -2,14 +2,21 @@ package monkey_evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	ast "myMonkey/monkey_ast"
 	object "myMonkey/monkey_object"
+	token "myMonkey/monkey_token"
+	"strconv"
+	"unicode/utf8"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 var builtins = map[string]*object.Builtin{
@@ -17,45 +24,58 @@ var builtins = map[string]*object.Builtin{
 		Name: "len",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
 			}
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Decimal{Value: float64(len(arg.Value))}
+				return &object.Integer{Value: int64(len(arg.Value))}
 			case *object.Array:
-				return &object.Decimal{Value: float64(len(arg.Value))}
+				return &object.Integer{Value: int64(len(arg.Value))}
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return newKindError(object.TYPE_ERROR, "argument to `len` not supported, got %s", args[0].Type())
 			}
 		},
 	},
+	"runeLen": &object.Builtin{
+		Name: "runeLen",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newKindError(object.TYPE_ERROR, "argument to `runeLen` must be STRING, got %s", args[0].Type())
+			}
+			return &object.Integer{Value: int64(utf8.RuneCountInString(str.Value))}
+		},
+	},
 	"truncate": &object.Builtin{
 		Name: "truncate",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 && len(args) != 3 {
-				return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2 or 3", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("first argument to `truncate` must be array, got %s", args[0].Type())
+				return newKindError(object.TYPE_ERROR, "first argument to `truncate` must be array, got %s", args[0].Type())
 			}
-			if args[1].Type() != object.DECIMAL_OBJ {
-				return newError("second argument to `truncate` must be decimal, got %s", args[1].Type())
+			if args[1].Type() != object.INTEGER_OBJ {
+				return newKindError(object.TYPE_ERROR, "second argument to `truncate` must be integer, got %s", args[1].Type())
 			}
-			if len(args) == 3 && args[2].Type() != object.DECIMAL_OBJ {
-				return newError("third argument to `truncate` must be decimal, got %s", args[2].Type())
+			if len(args) == 3 && args[2].Type() != object.INTEGER_OBJ {
+				return newKindError(object.TYPE_ERROR, "third argument to `truncate` must be integer, got %s", args[2].Type())
 			}
 			arr := args[0].(*object.Array)
 			length := len(arr.Value)
 			if length <= 0 {
 				return NULL
 			}
-			first := int(args[1].(*object.Decimal).Value)
+			first := int(args[1].(*object.Integer).Value)
 			if len(args) == 2 {
 				newArr := make([]object.Object, length-first)
 				copy(newArr, arr.Value[first:length])
 				return &object.Array{Value: newArr}
 			} else {
-				last := int(args[2].(*object.Decimal).Value)
+				last := int(args[2].(*object.Integer).Value)
 				if last < first {
 					first, last = last, first
 				}
@@ -69,10 +89,10 @@ var builtins = map[string]*object.Builtin{
 		Name: "append",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) < 2 {
-				return newError("wrong number of arguments. got=%d, want=2+.", len(args))
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2+.", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `append` must be ARRAY, got %s.", args[0].Type())
+				return newKindError(object.TYPE_ERROR, "argument to `append` must be ARRAY, got %s.", args[0].Type())
 			}
 			arr := args[0].(*object.Array)
 			length := len(arr.Value)
@@ -83,6 +103,113 @@ var builtins = map[string]*object.Builtin{
 			return &object.Array{Value: newElem}
 		},
 	},
+	"bigint": &object.Builtin{
+		Name: "bigint",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInt:
+				return &object.BigInt{Value: new(big.Int).Set(toBigInt(arg))}
+			case *object.Rational:
+				if !arg.Value.IsInt() {
+					return newKindError(object.VALUE_ERROR, "cannot convert %s to bigint without losing precision", arg.Inspect())
+				}
+				return &object.BigInt{Value: new(big.Int).Set(arg.Value.Num())}
+			case *object.Decimal:
+				if math.IsInf(arg.Value, 0) || math.IsNaN(arg.Value) || math.Trunc(arg.Value) != arg.Value {
+					return newKindError(object.VALUE_ERROR, "cannot convert %s to bigint without losing precision", arg.Inspect())
+				}
+				value, _ := big.NewFloat(arg.Value).Int(nil)
+				return &object.BigInt{Value: value}
+			case *object.String:
+				value, ok := new(big.Int).SetString(arg.Value, 0)
+				if !ok {
+					return newKindError(object.VALUE_ERROR, "could not parse %q as bigint", arg.Value)
+				}
+				return &object.BigInt{Value: value}
+			default:
+				return newKindError(object.TYPE_ERROR, "argument to `bigint` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"rational": &object.Builtin{
+		Name: "rational",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) == 2 {
+				num, den := toBigInt(args[0]), toBigInt(args[1])
+				if num == nil || den == nil {
+					return newKindError(object.TYPE_ERROR, "arguments to `rational` must be integers, got %s and %s", args[0].Type(), args[1].Type())
+				}
+				if den.Sign() == 0 {
+					return newKindError(object.ARITHMETIC_ERROR, "division by zero: rational(%s, %s)", num, den)
+				}
+				return &object.Rational{Value: new(big.Rat).SetFrac(num, den)}
+			}
+			if len(args) != 1 {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if str, ok := args[0].(*object.String); ok {
+				value, ok := new(big.Rat).SetString(str.Value)
+				if !ok {
+					return newKindError(object.VALUE_ERROR, "could not parse %q as rational", str.Value)
+				}
+				return &object.Rational{Value: value}
+			}
+			if !isNumeric(args[0]) {
+				return newKindError(object.TYPE_ERROR, "argument to `rational` not supported, got %s", args[0].Type())
+			}
+			value := toRational(args[0])
+			if value == nil {
+				return newKindError(object.VALUE_ERROR, "cannot convert %s to rational", args[0].Inspect())
+			}
+			return &object.Rational{Value: new(big.Rat).Set(value)}
+		},
+	},
+	"decimal": &object.Builtin{
+		Name: "decimal",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if str, ok := args[0].(*object.String); ok {
+				value, err := strconv.ParseFloat(str.Value, 64)
+				if err != nil {
+					return newKindError(object.VALUE_ERROR, "could not parse %q as decimal", str.Value)
+				}
+				return &object.Decimal{Value: value}
+			}
+			if !isNumeric(args[0]) {
+				return newKindError(object.TYPE_ERROR, "argument to `decimal` not supported, got %s", args[0].Type())
+			}
+			return &object.Decimal{Value: toFloat(args[0])}
+		},
+	},
+	"throw": &object.Builtin{
+		Name: "throw",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if exc, ok := args[0].(*object.Exception); ok && len(args) == 1 {
+				// rethrow a copy, leaving the caught exception as it was
+				rethrown := *exc.Err
+				rethrown.Trace = append([]object.Frame(nil), exc.Err.Trace...)
+				rethrown.Rethrown = true
+				return &rethrown
+			}
+			err := &object.Error{Message: args[0].Inspect(), Kind: object.ERROR, Value: args[0]}
+			if len(args) == 2 {
+				kind, ok := args[1].(*object.String)
+				if !ok {
+					return newKindError(object.TYPE_ERROR, "second argument to `throw` must be STRING, got %s", args[1].Type())
+				}
+				err.Kind = kind.Value
+			}
+			return err
+		},
+	},
 	"puts": &object.Builtin{
 		Name: "puts",
 		Fn: func(args ...object.Object) object.Object {
@@ -94,15 +221,86 @@ var builtins = map[string]*object.Builtin{
 	},
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// map and filter call back into applyFunc, which itself looks up builtins, so
+// they are registered here to avoid an initialization cycle.
+func init() {
+	builtins["map"] = &object.Builtin{
+		Name: "map",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newKindError(object.TYPE_ERROR, "first argument to `map` must be ARRAY, got %s", args[0].Type())
+			}
+			result := make([]object.Object, len(arr.Value))
+			for i, elem := range arr.Value {
+				mapped := applyFunc(args[1], []object.Object{elem}, token.Position{})
+				if isError(mapped) {
+					return mapped
+				}
+				result[i] = mapped
+			}
+			return &object.Array{Value: result}
+		},
+	}
+	builtins["filter"] = &object.Builtin{
+		Name: "filter",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newKindError(object.TYPE_ERROR, "first argument to `filter` must be ARRAY, got %s", args[0].Type())
+			}
+			result := []object.Object{}
+			for _, elem := range arr.Value {
+				keep := applyFunc(args[1], []object.Object{elem}, token.Position{})
+				if isError(keep) {
+					return keep
+				}
+				if isTrue(keep) {
+					result = append(result, elem)
+				}
+			}
+			return &object.Array{Value: result}
+		},
+	}
+}
+
+// newKindError returns an error of the given kind, one of the kind constants
+// in the object package, which catch exposes as e["kind"].
+func newKindError(kind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: kind}
 }
 
 func isError(obj object.Object) bool {
 	return obj != nil && obj.Type() == object.ERROR_OBJ
 }
 
+// isAbrupt reports whether obj ends the evaluation of the expression around
+// it: an error, or a break or continue from a block used as a value, as in
+// def r = if (done) { break; }.
+func isAbrupt(obj object.Object) bool {
+	return obj == BREAK || obj == CONTINUE || isError(obj)
+}
+
+// Eval evaluates node in env. Errors that do not know where they happened yet
+// are stamped with the position of the innermost node they passed through.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := chargeStep(env.Budget())
+	if result == nil {
+		result = eval(node, env)
+	}
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node.Statements, env)
@@ -110,84 +308,118 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 	case *ast.BlockStatement:
 		return evalBlock(node, env)
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.BigIntLiteral:
+		return &object.BigInt{Value: node.Value}
 	case *ast.DecimalLiteral:
 		return &object.Decimal{Value: node.Value}
 	case *ast.FunctionLiteral:
-		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+		return &object.Function{Name: node.Name, Parameters: node.Parameters, Defaults: node.Defaults, Rest: node.Rest, Body: node.Body, Env: env}
 	case *ast.Boolean:
 		return convertBoolean(node.Value)
 	case *ast.Identifier:
 		return evalIdent(node, env)
 	case *ast.PrefixExpression:
+		if isTarget(node.Right) && (node.Operator == "++" || node.Operator == "--") {
+			return evalBump(node.Operator, node.Right, false, env)
+		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefix(node.Operator, right)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
+		if err := chargeAlloc(env.Budget(), infixSize(node.Operator, left, right)); err != nil {
+			return err
+		}
 		return evalInfix(node.Operator, left, right)
+	case *ast.LogicalExpression:
+		return evalLogical(node, env)
 	case *ast.ConditionExpression:
 		return evalCondition(node, env)
-	case *ast.AssignExpression:
-		name := node.Name.Value
-		if !env.Exist(name) {
-			return newError("identifier not found: %s", name)
+	case *ast.MatchExpression:
+		return evalMatch(node, env)
+	case *ast.TryExpression:
+		return evalTry(node, env)
+	case *ast.TernaryExpression:
+		condition := Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
 		}
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
+		if isTrue(condition) {
+			return Eval(node.Consequence, env)
 		}
-		env.Set(name, val)
+		return Eval(node.Alternative, env)
+	case *ast.PostfixExpression:
+		return evalBump(node.Operator, node.Left, true, env)
+	case *ast.AssignExpression:
+		return evalAssign(node, env)
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-		args := evalExps(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-		return applyFunc(function, args)
+		return evalCall(node, env, false)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		var val object.Object
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok {
+			val = evalCall(call, env, true)
+		} else {
+			val = Eval(node.ReturnValue, env)
+		}
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
+		if node.Pattern != nil {
+			return bindPattern(node.Pattern, val, env)
+		}
 		env.Set(node.Name.Value, val)
 	case *ast.StringLiteral:
+		if err := chargeAlloc(env.Budget(), len(node.Value)); err != nil {
+			return err
+		}
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
 		elems := evalExps(node.Value, env)
-		if len(elems) == 1 && isError(elems[0]) {
+		if len(elems) == 1 && isAbrupt(elems[0]) {
 			return elems[0]
 		}
+		if err := chargeAlloc(env.Budget(), len(elems)); err != nil {
+			return err
+		}
 		return &object.Array{Value: elems}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		if node.Safe && left == NULL {
+			return NULL
+		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndex(left, index)
 	case *ast.HashLiteral:
 		return evalHash(node, env)
+	case *ast.LoopStatement:
+		return evalLoop(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	}
 	return nil
 }
@@ -198,7 +430,7 @@ func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 		result = Eval(stmt, env)
 		switch result := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			return forceTailCall(result.Value)
 		case *object.Error:
 			return result
 		}
@@ -210,8 +442,11 @@ func evalBlock(block *ast.BlockStatement, env *object.Environment) object.Object
 	var result object.Object
 	for _, stmt := range block.Statements {
 		result = Eval(stmt, env)
-		if result != nil && (result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ) {
-			return result
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return result
+			}
 		}
 	}
 	return result
@@ -234,8 +469,10 @@ func evalPrefix(op string, right object.Object) object.Object {
 		return evalBumpPlus(right)
 	case "--":
 		return evalBumpMinus(right)
+	case "~":
+		return evalBitNot(right)
 	default:
-		return newError("unknown operator: %s%s", op, right.Type())
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s%s", op, right.Type())
 	}
 }
 
@@ -253,37 +490,47 @@ func isTrue(obj object.Object) bool {
 }
 
 func evalMinus(right object.Object) object.Object {
-	if right.Type() != object.DECIMAL_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	if !isNumeric(right) {
+		return newKindError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Decimal).Value
-	return &object.Decimal{Value: -value}
+	return evalNumberInfix("-", &object.Integer{Value: 0}, right)
 }
 
 func evalBumpPlus(right object.Object) object.Object {
-	if right.Type() != object.DECIMAL_OBJ {
-		return newError("unknown operator: ++%s", right.Type())
+	if !isNumeric(right) {
+		return newKindError(object.TYPE_ERROR, "unknown operator: ++%s", right.Type())
 	}
-	value := right.(*object.Decimal).Value
-	return &object.Decimal{Value: value + 1}
+	return evalNumberInfix("+", right, &object.Integer{Value: 1})
 }
 
 func evalBumpMinus(right object.Object) object.Object {
-	if right.Type() != object.DECIMAL_OBJ {
-		return newError("unknown operator: --%s", right.Type())
+	if !isNumeric(right) {
+		return newKindError(object.TYPE_ERROR, "unknown operator: --%s", right.Type())
+	}
+	return evalNumberInfix("-", right, &object.Integer{Value: 1})
+}
+
+func evalBitNot(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInt:
+		return normalizeBigInt(new(big.Int).Not(right.Value))
+	}
+	if !isNumeric(right) {
+		return newKindError(object.TYPE_ERROR, "unknown operator: ~%s", right.Type())
 	}
-	value := right.(*object.Decimal).Value
-	return &object.Decimal{Value: value - 1}
+	return newKindError(object.TYPE_ERROR, "non-integral operand: ~%s", right.Type())
 }
 
 func evalInfix(op string, left, right object.Object) object.Object {
 	switch {
-	case left.Type() == object.STRING_OBJ && right.Type() == object.DECIMAL_OBJ:
+	case left.Type() == object.STRING_OBJ && isNumeric(right):
 		return evalStringMultiplication(op, left, right)
+	case isNumeric(left) && isNumeric(right):
+		return evalNumberInfix(op, left, right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), op, right.Type())
-	case left.Type() == object.DECIMAL_OBJ && right.Type() == object.DECIMAL_OBJ:
-		return evalDecimalInfix(op, left, right)
+		return newKindError(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), op, right.Type())
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringConcentration(op, left, right)
 	case op == "==":
@@ -291,46 +538,13 @@ func evalInfix(op string, left, right object.Object) object.Object {
 	case op == "!=":
 		return convertBoolean(left != right)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
-	}
-}
-
-func evalDecimalInfix(op string, leftObj, rightObj object.Object) object.Object {
-	left := leftObj.(*object.Decimal).Value
-	right := rightObj.(*object.Decimal).Value
-	switch op {
-	case "+":
-		return &object.Decimal{Value: left + right}
-	case "-":
-		return &object.Decimal{Value: left - right}
-	case "*":
-		return &object.Decimal{Value: left * right}
-	case "/":
-		return &object.Decimal{Value: left / right}
-	case "<<":
-		return &object.Decimal{Value: float64(int64(left) << int64(right))}
-	case ">>":
-		return &object.Decimal{Value: float64(int64(left) >> int64(right))}
-	case "<":
-		return convertBoolean(left < right)
-	case ">":
-		return convertBoolean(left > right)
-	case "==":
-		return convertBoolean(left == right)
-	case "!=":
-		return convertBoolean(left != right)
-	case ">=":
-		return convertBoolean(left >= right)
-	case "<=":
-		return convertBoolean(left <= right)
-	default:
-		return newError("unknown operator: %s %s %s", leftObj.Type(), op, rightObj.Type())
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
 }
 
 func evalStringConcentration(op string, left, right object.Object) object.Object {
 	if op != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -339,10 +553,10 @@ func evalStringConcentration(op string, left, right object.Object) object.Object
 
 func evalStringMultiplication(op string, left, right object.Object) object.Object {
 	if op != "*" {
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
 	leftVal := left.(*object.String).Value
-	rightVal := int(right.(*object.Decimal).Value)
+	rightVal := int(toFloat(right))
 	finalVal := ""
 	for i := 0; i < rightVal; i++ {
 		finalVal += leftVal
@@ -350,12 +564,43 @@ func evalStringMultiplication(op string, left, right object.Object) object.Objec
 	return &object.String{Value: finalVal}
 }
 
+func evalLogical(le *ast.LogicalExpression, env *object.Environment) object.Object {
+	left := Eval(le.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	switch le.Operator {
+	case "&&":
+		if !isTrue(left) {
+			return FALSE
+		}
+	case "||":
+		if isTrue(left) {
+			return TRUE
+		}
+	case "??":
+		if left != NULL {
+			return left
+		}
+		return Eval(le.Right, env)
+	default:
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s", le.Operator, left.Type())
+	}
+	right := Eval(le.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+	return convertBoolean(isTrue(right))
+}
+
 func evalCondition(ce *ast.ConditionExpression, env *object.Environment) object.Object {
 	condition := Eval(ce.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	} else if isTrue(condition) {
 		return Eval(ce.True, env)
+	} else if ce.ElseIf != nil {
+		return evalCondition(ce.ElseIf, env)
 	} else if ce.False != nil {
 		return Eval(ce.False, env)
 	} else {
@@ -363,6 +608,70 @@ func evalCondition(ce *ast.ConditionExpression, env *object.Environment) object.
 	}
 }
 
+// evalTry runs the try block and, if it fails with anything but a limit error,
+// the catch block with the error bound as an Exception. The finally block
+// always runs last; an error, ret, break or continue inside it replaces the
+// result of the other blocks. A tail call in the try or catch block is made
+// on the spot, so that its errors are caught and it runs before finally.
+func evalTry(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := forceReturnedCall(Eval(node.Block, env))
+	if isLimitError(result) {
+		// the evaluation is out of budget; neither catch nor finally may run
+		return result
+	}
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if node.Param != nil {
+			catchEnv.Set(node.Param.Value, &object.Exception{Err: err})
+		}
+		result = forceReturnedCall(Eval(node.Catch, catchEnv))
+	}
+	if node.Finally != nil {
+		final := Eval(node.Finally, env)
+		if final == BREAK || final == CONTINUE || isError(final) {
+			return final
+		}
+		if _, ok := final.(*object.ReturnValue); ok {
+			return final
+		}
+	}
+	return result
+}
+
+func evalLoop(loop *ast.LoopStatement, env *object.Environment) object.Object {
+	loopEnv := env
+	if loop.Initial != nil {
+		loopEnv = object.NewEnclosedEnvironment(env)
+		initial := Eval(loop.Initial, loopEnv)
+		if isError(initial) {
+			return initial
+		}
+	}
+	for {
+		condition := Eval(loop.Condition, loopEnv)
+		if isError(condition) {
+			return condition
+		}
+		if !isTrue(condition) {
+			break
+		}
+		result := Eval(loop.Body, loopEnv)
+		if result == BREAK {
+			break
+		}
+		if result != nil && (result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ) {
+			return result
+		}
+		if loop.AfterBlock != nil {
+			after := Eval(loop.AfterBlock, loopEnv)
+			if isError(after) {
+				return after
+			}
+		}
+	}
+	return NULL
+}
+
 func evalIdent(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
@@ -370,14 +679,14 @@ func evalIdent(node *ast.Identifier, env *object.Environment) object.Object {
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
-	return newError("identifier not found: %s", node.Value)
+	return newKindError(object.NAME_ERROR, "identifier not found: %s", node.Value)
 }
 
 func evalExps(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, exp := range exps {
 		evaluated := Eval(exp, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -385,25 +694,202 @@ func evalExps(exps []ast.Expression, env *object.Environment) []object.Object {
 	return result
 }
 
-func applyFunc(fn object.Object, args []object.Object) object.Object {
+// applyFunc calls fn from the call site at pos. Errors unwinding out of the
+// call get a frame appended to their trace; builtins only get one when the
+// error was raised further in, e.g. by a function passed to map.
+func applyFunc(fn object.Object, args []object.Object, pos token.Position) object.Object {
 	switch function := fn.(type) {
 	case *object.Function:
-		env := extendFuncEnv(function, args)
-		evaluated := Eval(function.Body, env)
-		return getReturnValue(evaluated)
+		// Tail calls come back as TailCall objects and are made by this loop,
+		// so a chain of them runs in constant stack space. An error is traced
+		// to the function that failed, called from where the chain began. An
+		// error binding the arguments belongs to the function making the call,
+		// since none of the callee's code has run.
+		var caller *object.Function
+		var callPos token.Position
+		for {
+			failed := function
+			env, result := extendFuncEnv(function, args)
+			if result == nil {
+				result = callFunc(function, env)
+			} else if caller == nil {
+				return result
+			} else {
+				if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+					err.Pos = callPos
+				}
+				failed = caller
+			}
+			if tc, ok := result.(*object.TailCall); ok {
+				caller, callPos = function, tc.Pos
+				function, args = tc.Function, tc.Args
+				continue
+			}
+			if err, ok := result.(*object.Error); ok {
+				name := failed.Name
+				if name == "" {
+					name = "<anonymous>"
+				}
+				err.Trace = append(err.Trace, object.Frame{Function: name, Pos: pos})
+			}
+			return result
+		}
 	case *object.Builtin:
-		return function.Fn(args...)
+		result := callBuiltin(function, args)
+		if err, ok := result.(*object.Error); ok {
+			if err.Rethrown {
+				// the error comes from where it was first raised, not from throw
+				err.Rethrown = false
+			} else if err.Pos.IsValid() {
+				err.Trace = append(err.Trace, object.Frame{Function: function.Name, Pos: pos})
+			}
+		}
+		return result
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newKindError(object.TYPE_ERROR, "not a function: %s", fn.Type())
+	}
+}
+
+// Apply calls fn, a Monkey function or builtin, with args. It is how a Go
+// program calls back into Monkey code.
+func Apply(fn object.Object, args []object.Object) object.Object {
+	return applyFunc(fn, args, token.Position{})
+}
+
+// callFunc runs the body of fn once in env, which holds its arguments. Its
+// result may be a TailCall.
+func callFunc(fn *object.Function, env *object.Environment) object.Object {
+	budget := env.Budget()
+	if err := enterCall(budget); err != nil {
+		return err
+	}
+	defer leaveCall(budget)
+	return getReturnValue(Eval(fn.Body, env))
+}
+
+// evalCall evaluates a call. In tail position, that is directly after ret, a
+// call to a Monkey function is not made but returned as a TailCall, which the
+// function application running the ret makes in its place.
+func evalCall(node *ast.CallExpression, env *object.Environment, tail bool) object.Object {
+	function := Eval(node.Function, env)
+	if isAbrupt(function) {
+		return function
+	}
+	args := evalExps(node.Arguments, env)
+	if len(args) == 1 && isAbrupt(args[0]) {
+		return args[0]
+	}
+	switch fn := function.(type) {
+	case *object.Function:
+		if tail {
+			return &object.TailCall{Function: fn, Args: args, Pos: node.Pos()}
+		}
+	case *object.Builtin:
+		result := applyFunc(fn, args, node.Pos())
+		if !isError(result) {
+			// builtins have no environment to charge their results to
+			if err := chargeAlloc(env.Budget(), sizeOf(result)); err != nil {
+				return err
+			}
+		}
+		return result
+	}
+	return applyFunc(function, args, node.Pos())
+}
+
+// callBuiltin calls fn, turning a panic in it into an error so that a faulty
+// builtin from the host cannot crash the program embedding the interpreter.
+func callBuiltin(fn *object.Builtin, args []object.Object) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			name := fn.Name
+			if name == "" {
+				name = "builtin"
+			}
+			result = newKindError(object.ERROR, "%s panicked: %v", name, r)
+		}
+	}()
+	return fn.Fn(args...)
+}
+
+// forceTailCall makes the call if obj is a TailCall that has nobody left to
+// make it, as with a ret at the top level.
+func forceTailCall(obj object.Object) object.Object {
+	if tc, ok := obj.(*object.TailCall); ok {
+		return applyFunc(tc.Function, tc.Args, tc.Pos)
 	}
+	return obj
 }
 
-func extendFuncEnv(fn *object.Function, args []object.Object) *object.Environment {
+// forceReturnedCall is forceTailCall for the result of a block: the call is
+// made and its result returned in its place.
+func forceReturnedCall(obj object.Object) object.Object {
+	rv, ok := obj.(*object.ReturnValue)
+	if !ok {
+		return obj
+	}
+	if _, ok := rv.Value.(*object.TailCall); !ok {
+		return obj
+	}
+	result := forceTailCall(rv.Value)
+	if isError(result) {
+		return result
+	}
+	return &object.ReturnValue{Value: result}
+}
+
+// extendFuncEnv binds the arguments of a call to fn's parameters. Missing
+// arguments take their default, evaluated in the new scope so that it can
+// refer to earlier parameters, and extra ones are collected into the rest
+// parameter.
+func extendFuncEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
+	if err := checkArity(fn, len(args)); err != nil {
+		return nil, err
+	}
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for i, param := range fn.Parameters {
-		env.Set(param.Value, args[i])
+		if i < len(args) {
+			env.Set(param.Value, args[i])
+			continue
+		}
+		val := Eval(fn.Defaults[i], env)
+		if isError(val) {
+			return nil, val
+		}
+		env.Set(param.Value, val)
+	}
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Value: rest})
 	}
-	return env
+	return env, nil
+}
+
+func checkArity(fn *object.Function, got int) object.Object {
+	required := 0
+	for _, def := range fn.Defaults {
+		if def == nil {
+			required++
+		}
+	}
+	// Functions built by hand may leave Defaults empty.
+	if len(fn.Defaults) == 0 {
+		required = len(fn.Parameters)
+	}
+	switch {
+	case fn.Rest != nil && got < required:
+		return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%d+", got, required)
+	case fn.Rest != nil:
+		return nil
+	case required == len(fn.Parameters) && got != required:
+		return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%d", got, required)
+	case got < required || got > len(fn.Parameters):
+		return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%d..%d", got, required, len(fn.Parameters))
+	}
+	return nil
 }
 
 func getReturnValue(obj object.Object) object.Object {
@@ -415,18 +901,23 @@ func getReturnValue(obj object.Object) object.Object {
 
 func evalIndex(left, index object.Object) object.Object {
 	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.DECIMAL_OBJ:
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndex(left, index)
+	case left.Type() == object.EXCEPTION_OBJ && index.Type() == object.STRING_OBJ:
+		if field := left.(*object.Exception).Field(index.(*object.String).Value); field != nil {
+			return field
+		}
+		return NULL
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newKindError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
 	}
 }
 
 func evalArrayIndex(array, index object.Object) object.Object {
 	arrayObj := array.(*object.Array)
-	idx := int64(index.(*object.Decimal).Value)
+	idx := index.(*object.Integer).Value
 	maxLen := int64(len(arrayObj.Value))
 	if idx < 0 {
 		idx += maxLen
@@ -441,7 +932,7 @@ func evalHashIndex(hash, index object.Object) object.Object {
 	hashObj := hash.(*object.Hash)
 	k, ok := index.(object.HashAble)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newKindError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
 	}
 	pair, ok := hashObj.Pairs[k.HashKey()]
 	if !ok {
@@ -452,21 +943,25 @@ func evalHashIndex(hash, index object.Object) object.Object {
 
 func evalHash(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
-	for kNode, vNode := range node.Pairs {
+	for _, kNode := range node.Keys {
+		vNode := node.Pairs[kNode]
 		k := Eval(kNode, env)
-		if isError(k) {
+		if isAbrupt(k) {
 			return k
 		}
 		hashKey, ok := k.(object.HashAble)
 		if !ok {
-			return newError("unusable as hash key: %s", k.Type())
+			return newKindError(object.TYPE_ERROR, "unusable as hash key: %s", k.Type())
 		}
 		v := Eval(vNode, env)
-		if isError(v) {
+		if isAbrupt(v) {
 			return v
 		}
 		hashed := hashKey.HashKey()
 		pairs[hashed] = object.HashPair{Key: k, Value: v}
 	}
+	if err := chargeAlloc(env.Budget(), len(pairs)); err != nil {
+		return err
+	}
 	return &object.Hash{Pairs: pairs}
 }
@@ -1,38 +1,76 @@
 package monkey_evaluator
 
 import (
+	"context"
 	lexer "myMonkey/monkey_lexer"
 	object "myMonkey/monkey_object"
 	parser "myMonkey/monkey_parser"
+	token "myMonkey/monkey_token"
 	"testing"
+	"time"
 )
 
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"++5", 6},
+		{"--10", 9},
+		{"5+5+5+5-10", 10},
+		{"2*2*2*2*2", 32},
+		{"-50+100+-50", 0},
+		{"5*2+10", 20},
+		{"5+2*10", 25},
+		{"20+2*-10", 0},
+		{"50/2*2+10", 60},
+		{"2*(5+10)", 30},
+		{"3*3*3+10", 37},
+		{"3*(3*3)+10", 37},
+		{"(5+10*2+15/3)*2+-10", 50},
+		{"2<<5", 64},
+		{"64>>5", 2},
+		{"7/2", 3},
+		{"-7/2", -3},
+		{"7%3", 1},
+		{"-7%3", -1},
+		{"0xFF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0xF0 >> 4", 15},
+		{"9223372036854775807", 9223372036854775807},
+		{"-9223372036854775807 - 1", -9223372036854775808},
+		{"1 << 62", 4611686018427387904},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		testIntegerObj(t, evaluated, test.expected)
+	}
+}
+
 func TestEvalDecimalExpression(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected float64
 	}{
-		{"5", 5.0},
-		{"10", 10.0},
 		{"9.2", 9.2},
-		{"-5", -5.0},
-		{"-10", -10.0},
 		{"-9.2", -9.2},
-		{"++5", 6.0},
-		{"--10", 9.0},
-		{"5+5+5+5-10", 10.0},
-		{"2*2*2*2*2", 32.0},
-		{"-50+100+-50", 0.0},
-		{"5*2+10", 20.0},
-		{"5+2*10", 25.0},
-		{"20+2*-10", 0.0},
-		{"50/2*2+10", 60.0},
-		{"2*(5+10)", 30.0},
-		{"3*3*3+10", 37.0},
-		{"3*(3*3)+10", 37.0},
-		{"(5+10*2+15/3)*2+-10", 50},
-		{"2<<5", 64.0},
-		{"64>>5", 2.0},
+		{"++9.5", 10.5},
+		{"--9.5", 8.5},
+		{".5", 0.5},
+		{"2.5e3", 2500.0},
+		{"1e-3", 0.001},
+		{"1.5*2", 3.0},
+		{"1+0.5", 1.5},
+		{"7/2.0", 3.5},
+		{"7.5%2", 1.5},
+		{"(5+10*2+15/3.0)*2+-10", 50.0},
 	}
 
 	for _, test := range tests {
@@ -41,6 +79,168 @@ func TestEvalDecimalExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerArithmeticErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1/0", "division by zero: 1 / 0"},
+		{"1%0", "division by zero: 1 % 0"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"1.5 << 1", "non-integral operand: DECIMAL << INTEGER"},
+		{"1.5 & 1", "non-integral operand: DECIMAL & INTEGER"},
+		{"1 | rational(1, 2)", "non-integral operand: INTEGER | RATIONAL"},
+		{"~2.5", "non-integral operand: ~DECIMAL"},
+		{`~"a"`, "unknown operator: ~STRING"},
+		{"true ^ false", "unknown operator: BOOLEAN ^ BOOLEAN"},
+		{"7 ~/ 0", "division by zero: 7 ~/ 0"},
+		{"7.5 ~/ 0", "division by zero: 7.500000 ~/ 0"},
+		{"0 ** -1", "division by zero: 0 ** -1"},
+		{"2 ** 10000000", "exponent too large: 2 ** 10000000"},
+		{"bigint(1) << 2000000", "shift count too large: 1 << 2000000"},
+		{"bigint(5) / 0", "division by zero: 5 / 0"},
+		{"rational(1, 0)", "division by zero: rational(1, 0)"},
+		{"rational(1, 2) / 0", "division by zero: 1/2 / 0"},
+		{"bigint(1.5)", "cannot convert 1.500000 to bigint without losing precision"},
+		{`bigint("12x")`, `could not parse "12x" as bigint`},
+		{`rational("abc")`, `could not parse "abc" as rational`},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", test.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, test.expected)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		objType  object.ObjectType
+	}{
+		{"7 % 3", "1", object.INTEGER_OBJ},
+		{"-7 % 3", "-1", object.INTEGER_OBJ},
+		{"7.5 % 2", "1.500000", object.DECIMAL_OBJ},
+		{"rational(7, 2) % 2", "1.5", object.RATIONAL_OBJ},
+		{"2 ** 10", "1024", object.INTEGER_OBJ},
+		{"2 ** 3 ** 2", "512", object.INTEGER_OBJ},
+		{"-2 ** 2", "-4", object.INTEGER_OBJ},
+		{"(-2) ** 3", "-8", object.INTEGER_OBJ},
+		{"2 ** 64", "18446744073709551616", object.BIGINT_OBJ},
+		{"2 ** -2", "0.25", object.RATIONAL_OBJ},
+		{"rational(2, 3) ** 2", "4/9", object.RATIONAL_OBJ},
+		{"4 ** 0.5", "2.000000", object.DECIMAL_OBJ},
+		{"1.5 ** 2", "2.250000", object.DECIMAL_OBJ},
+		{"7 ~/ 2", "3", object.INTEGER_OBJ},
+		{"-7 ~/ 2", "-4", object.INTEGER_OBJ},
+		{"-7 / 2", "-3", object.INTEGER_OBJ},
+		{"7 / -2", "-3", object.INTEGER_OBJ},
+		{"7 ~/ -2", "-4", object.INTEGER_OBJ},
+		{"-7 / -2", "3", object.INTEGER_OBJ},
+		{"-7 ~/ -2", "3", object.INTEGER_OBJ},
+		{"-6 / 2 == -6 ~/ 2", "true", object.BOOLEAN_OBJ},
+		{"-(1 << 70) / 3", "-393530540239137101141", object.BIGINT_OBJ},
+		{"-(1 << 70) ~/ 3", "-393530540239137101142", object.BIGINT_OBJ},
+		{"7.5 ~/ 2", "3", object.INTEGER_OBJ},
+		{"-7.5 ~/ 2", "-4", object.INTEGER_OBJ},
+		{"rational(7, 2) ~/ rational(1, 3)", "10", object.INTEGER_OBJ},
+		{"1e30 ~/ 1", "1000000000000000019884624838656", object.BIGINT_OBJ},
+		{"6 & 3", "2", object.INTEGER_OBJ},
+		{"6 | 3", "7", object.INTEGER_OBJ},
+		{"6 ^ 3", "5", object.INTEGER_OBJ},
+		{"~5", "-6", object.INTEGER_OBJ},
+		{"~(1 << 70)", "-1180591620717411303425", object.BIGINT_OBJ},
+		{"((1 << 70) | 1) & 3", "1", object.INTEGER_OBJ},
+		{"1 | 2 ^ 3 & 4", "3", object.INTEGER_OBJ},
+		{"1 + 2 & 3", "3", object.INTEGER_OBJ},
+		{"1 | 2 == 3", "true", object.BOOLEAN_OBJ},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated == nil || evaluated.Type() != test.objType || evaluated.Inspect() != test.expected {
+			t.Errorf("%s: got=%T (%+v), want %s %s", test.input, evaluated, evaluated, test.objType, test.expected)
+		}
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		objType  object.ObjectType
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", object.BIGINT_OBJ},
+		{"-9223372036854775807 - 2", "-9223372036854775809", object.BIGINT_OBJ},
+		{"4611686018427387904 * 2", "9223372036854775808", object.BIGINT_OBJ},
+		{"1 << 63", "9223372036854775808", object.BIGINT_OBJ},
+		{"1 << 100", "1267650600228229401496703205376", object.BIGINT_OBJ},
+		{"def a = 9223372036854775807; ++a", "9223372036854775808", object.BIGINT_OBJ},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808", object.BIGINT_OBJ},
+		{"123456789012345678901234567890", "123456789012345678901234567890", object.BIGINT_OBJ},
+		{"0xFFFFFFFFFFFFFFFFFF", "4722366482869645213695", object.BIGINT_OBJ},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807", object.INTEGER_OBJ},
+		{"(1 << 100) >> 99", "2", object.INTEGER_OBJ},
+		{"(1 << 100) % 7", "2", object.INTEGER_OBJ},
+		{"bigint(5)", "5", object.BIGINT_OBJ},
+		{`bigint("0x10")`, "16", object.BIGINT_OBJ},
+		{"bigint(1e20)", "100000000000000000000", object.BIGINT_OBJ},
+		{`rational("0.1") + rational("0.2")`, "0.3", object.RATIONAL_OBJ},
+		{"rational(1, 3)", "1/3", object.RATIONAL_OBJ},
+		{"rational(1, 3) * 3", "1", object.RATIONAL_OBJ},
+		{"rational(0.1) * 10", "1", object.RATIONAL_OBJ},
+		{`rational("19.99") * 3`, "59.97", object.RATIONAL_OBJ},
+		{"rational(1, 4) + (1 << 70)", "1180591620717411303424.25", object.RATIONAL_OBJ},
+		{"rational(1, 2) + 0.25", "0.750000", object.DECIMAL_OBJ},
+		{"decimal(rational(1, 4))", "0.250000", object.DECIMAL_OBJ},
+		{`decimal("2.5")`, "2.500000", object.DECIMAL_OBJ},
+		{"decimal(1 << 70) > 1e21", "true", object.BOOLEAN_OBJ},
+		{"(1 << 70) > 5", "true", object.BOOLEAN_OBJ},
+		{"rational(1, 3) < rational(1, 2)", "true", object.BOOLEAN_OBJ},
+		{"bigint(7) == 7", "true", object.BOOLEAN_OBJ},
+		{`{bigint(7): "seven"}[7]`, "seven", object.STRING_OBJ},
+		{`{7: "seven"}[rational(14, 2)]`, "seven", object.STRING_OBJ},
+		{`{7: "seven"}[7.0]`, "seven", object.STRING_OBJ},
+		{`{rational(1, 2): "half"}[0.5]`, "half", object.STRING_OBJ},
+		{`{0.25: "quarter"}[rational(1, 4)]`, "quarter", object.STRING_OBJ},
+		{`{1.5: "x"}[1.7] ?? "none"`, "none", object.STRING_OBJ},
+		{`{-3.0: "minus three"}[-3]`, "minus three", object.STRING_OBJ},
+		{`{1e20: "big"}[bigint(1e20)]`, "big", object.STRING_OBJ},
+		{`{1.5: "x"}[1.5]`, "x", object.STRING_OBJ},
+		{`{7: "seven"}[7.5] ?? "none"`, "none", object.STRING_OBJ},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated == nil || evaluated.Type() != test.objType || evaluated.Inspect() != test.expected {
+			t.Errorf("%s: got=%T (%+v), want %s %s", test.input, evaluated, evaluated, test.objType, test.expected)
+		}
+	}
+}
+
+func TestNumberComparisonAndInspect(t *testing.T) {
+	testBooleanObj(t, testEval("1 == 1.0"), true)
+	testBooleanObj(t, testEval("2 > 1.5"), true)
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3", "3"},
+		{"6/2", "3"},
+		{"-42", "-42"},
+		{"1.5", "1.500000"},
+	}
+	for _, test := range tests {
+		if got := testEval(test.input).Inspect(); got != test.expected {
+			t.Errorf("%s: wrong inspect. got=%q, want=%q", test.input, got, test.expected)
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -71,45 +271,254 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestLogicalExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 == 2", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"1 && 2", true},
+		{"0 || false", true},
+		{"!true || !false", true},
+		{"false && foobar", false},
+		{"true || foobar()", true},
+		{"def x = 0; false && (x = 1); x == 0", true},
+		{"def x = 0; true && (x = 1); x == 1", true},
+	}
+	for _, test := range tests {
+		testBooleanObj(t, testEval(test.input), test.expected)
+	}
+	evaluated := testEval("true && foobar")
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "identifier not found: foobar" {
+		t.Errorf("wrong error. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
 func TestConditionExpression(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
-		{"if(true){10}", 10.0},
+		{"if(true){10}", 10},
 		{"if(false){10}", nil},
-		{"if(1){10}", 10.0},
-		{"if(1<2){10}", 10.0},
+		{"if(1){10}", 10},
+		{"if(1<2){10}", 10},
 		{"if(1>2){10}", nil},
-		{"if(1<2){10}else{20}", 10.0},
-		{"if(1>2){10}else{20}", 20.0},
+		{"if(1<2){10}else{20}", 10},
+		{"if(1>2){10}else{20}", 20},
 	}
 	for _, test := range tests {
 		evaluated := testEval(test.input)
-		decimal, ok := test.expected.(float64)
+		integer, ok := test.expected.(int)
 		if ok {
-			testDecimalObj(t, evaluated, decimal)
+			testIntegerObj(t, evaluated, int64(integer))
+		} else {
+			testNullObj(t, evaluated)
+		}
+	}
+}
+
+func TestElseIf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"def x=1;if(x==0){10}else if(x==1){20}else{30}", 20},
+		{"def x=2;if(x==0){10}else if(x==1){20}else{30}", 30},
+		{"def x=0;if(x==0){10}else if(x==1){20}else{30}", 10},
+		{"def x=5;if(x==0){10}else if(x==1){20}", nil},
+		{"def x=3;if(x<1){1}else if(x<2){2}else if(x<4){3}else{4}", 3},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if integer, ok := test.expected.(int); ok {
+			testIntegerObj(t, evaluated, int64(integer))
 		} else {
 			testNullObj(t, evaluated)
 		}
 	}
 }
 
+func TestTernaryAndCoalesce(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true ? 1 : 2", 1},
+		{"false ? 1 : 2", 2},
+		{"def x=5;x > 3 ? x * 2 : x", 10},
+		{"def x=0;x == 0 ? 10 : x == 1 ? 20 : 30", 10},
+		{"def x=1;x == 0 ? 10 : x == 1 ? 20 : 30", 20},
+		{"def x=2;x == 0 ? 10 : x == 1 ? 20 : 30", 30},
+		{"def f=func(a){ret a;};f(1 < 2 ? 7 : 8)", 7},
+		{"def x=true ? 3 : 4;x", 3},
+		{"false ? undefined : 4", 4},
+		{"1 ?? 2", 1},
+		{"[][0] ?? 2", 2},
+		{"false ?? 2", false},
+		{"[][0] ?? [][1] ?? 3", 3},
+		{"1 ?? undefined", 1},
+		{`def h={"a":{"b":1}};h["a"]?.["b"]`, 1},
+		{`def h={};h["a"]?.["b"]`, nil},
+		{`def h={};h["a"]?.[undefined]`, nil},
+		{`def h={};h["a"]?.["b"] ?? 9`, 9},
+		{`def a=[[1,2]];a[0]?.[1]`, 2},
+		{`def x=true;x ?[1] : 2`, "[1]"},
+		{`def x=false;x ?[1] : [2, 3]`, "[2, 3]"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObj(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObj(t, evaluated, expected)
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("%s: got=%T (%+v), want %s", test.input, evaluated, evaluated, expected)
+			}
+		default:
+			testNullObj(t, evaluated)
+		}
+	}
+
+	evaluated := testEval(`def h={};h["a"]["b"]`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "index operator not supported: NULL" {
+		t.Errorf("expected error for plain index on null, got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestPipeOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def double=func(x){ret x*2;};3 |> double", "6"},
+		{"def add=func(a,b){ret a+b;};3 |> add(4)", "7"},
+		{"def sub=func(a,b){ret a-b;};10 |> sub(4) |> sub(1)", "5"},
+		{"def double=func(x){ret x*2;};def isEven=func(x){ret x%4==0;};[1,2,3,4] |> map(double) |> filter(isEven)", "[4, 8]"},
+		{"[1,2,3] |> map(func(x){ret x*x;}) |> len", "3"},
+		{`("abc" |> len) == 3`, "true"},
+		{`"abc" |> len == 3`, "true"},
+		{"def double=func(x){ret x*2;};3 |> double == 6", "true"},
+		{"def double=func(x){ret x*2;};3 |> double + 1", "7"},
+		{"def add=func(a,b){ret a+b;};3 |> add(4) * 2 |> add(1)", "15"},
+		{`def fs={"inc": func(x){ret x+1;}};1 |> fs["inc"]`, "2"},
+		{"2 |> (x) => x * 10", "20"},
+		{"1 + 2 |> func(x){ret x*10;}", "30"},
+		{"[] |> filter(func(x){ret true;})", "[]"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated == nil || evaluated.Inspect() != test.expected {
+			t.Errorf("%s: got=%T (%+v), want %s", test.input, evaluated, evaluated, test.expected)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"def n=3;5 |> n", "not a function: INTEGER"},
+		{"5 |> map(len)", "first argument to `map` must be ARRAY, got INTEGER"},
+		{`[1, "a"] |> map(func(x){ret x+1;})`, "unknown operator: STRING + INTEGER"},
+	}
+	for _, test := range errTests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", test.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, test.expected)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match(2){1 => "one", 2 => "two", _ => "many"}`, "two"},
+		{`match(7){1 => "one", 2 => "two", _ => "many"}`, "many"},
+		{`match(2.0){2 => "two", _ => "other"}`, "two"},
+		{`match("b"){"a" => 1, "b" => 2}`, 2},
+		{`match(true){false => 0, true => 1}`, 1},
+		{`match(9){1 => 1}`, nil},
+		{`match(5){n if n > 3 => n * 2, n => n}`, 10},
+		{`match(2){n if n > 3 => n * 2, n => n}`, 2},
+		{`match([1, 2]){[a] => a, [a, b] => a + b, _ => 0}`, 3},
+		{`match([1, [2, 3]]){[1, [_, c]] => c, _ => 0}`, 3},
+		{`match([2, 2]){[1, _] => 1, [a, b] if a == b => 2, _ => 3}`, 2},
+		{`match({"kind": "sq", "side": 3}){{"kind": "circle", "r": r} => r, {"kind": "sq", "side": s} => s * s}`, 9},
+		{`match({"a": 1}){{"b": b} => b, _ => 0}`, 0},
+		{`match(4){0 => 0, n => { def m = n * n; m + 1 }}`, 17},
+		{`def f=func(x){match(x){0 => { ret 100; } _ => 1}; ret 2;}; f(0);`, 100},
+		{`def i=0; while(true){ def r = match(i){ 3 => { break; }, _ => i }; i++; }; i`, 3},
+		{`def s=0; for(def i=0; i<4; i++){ s += match(i){ 2 => { continue; }, n => n }; }; s`, 4},
+		{`def n=1;match(n){x => x};x;`, "identifier not found: x"},
+		{`def a = 1; match(2){a => "a", _ => "other"}`, "a"},
+		{`def a = 1; match(2){^a => "a", _ => "other"}`, "other"},
+		{`def a = 2; match(2){^a => "a", _ => "other"}`, "a"},
+		{`def a = 2; match(2.0){^a => "a", _ => "other"}`, "a"},
+		{`def want = "ok"; match({"status": "ok", "n": 4}){{"status": ^want, "n": n} => n, _ => 0}`, 4},
+		{`match([3, 3]){[x, ^x] => x, _ => 0}`, 3},
+		{`match([3, 4]){[x, ^x] => x, _ => 0}`, 0},
+		{`match(1){^missing => 1, _ => 0}`, "identifier not found: missing"},
+		{`match({"k": "name", "name": 5}){{"k": key, key: v} => v, _ => 0}`, 5},
+		{`match({"b": 1}){{a: 1, b: 2} => 1, _ => 0}`, "identifier not found: a"},
+		{`def log = ""; def k = func(s) { log = log + s; s }; {k("a"): 1, k("b"): 2, k("c"): 3}; log`, "abc"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObj(t, evaluated, int64(expected))
+		case string:
+			if str, ok := evaluated.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("%s: got=%q, want=%q", test.input, str.Value, expected)
+				}
+			} else if err, ok := evaluated.(*object.Error); !ok || err.Message != expected {
+				t.Errorf("%s: got=%T (%+v), want %q", test.input, evaluated, evaluated, expected)
+			}
+		default:
+			testNullObj(t, evaluated)
+		}
+	}
+
+	// Hash patterns are tried key by key in source order, which Go's random
+	// map iteration would only sometimes get right.
+	for i := 0; i < 20; i++ {
+		testIntegerObj(t, testEval(`match({"k": "name", "name": 5}){{"k": key, key: v} => v, _ => 0}`), 5)
+	}
+}
+
 func TestReturnValue(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected float64
+		expected int64
 	}{
-		{"ret 10;", 10.0},
-		{"ret 10;9;", 10.0},
-		{"ret 2*5;9;", 10.0},
-		{"9;ret 2*5;9;", 10.0},
-		{"if(10>1){if(10>1){ret 10;}ret 1;}", 10.0},
+		{"ret 10;", 10},
+		{"ret 10;9;", 10},
+		{"ret 2*5;9;", 10},
+		{"9;ret 2*5;9;", 10},
+		{"if(10>1){if(10>1){ret 10;}ret 1;}", 10},
 	}
 
 	for _, test := range tests {
 		evaluated := testEval(test.input)
-		testDecimalObj(t, evaluated, test.expected)
+		testIntegerObj(t, evaluated, test.expected)
 	}
 }
 
@@ -118,8 +527,8 @@ func TestErrorHandling(t *testing.T) {
 		input    string
 		expected string
 	}{
-		{"5+true;", "type mismatch: DECIMAL + BOOLEAN"},
-		{"5+true;5;", "type mismatch: DECIMAL + BOOLEAN"},
+		{"5+true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5+true;5;", "type mismatch: INTEGER + BOOLEAN"},
 		{"-true", "unknown operator: -BOOLEAN"},
 		{"true+false;", "unknown operator: BOOLEAN + BOOLEAN"},
 		{"5;true+false;5;", "unknown operator: BOOLEAN + BOOLEAN"},
@@ -141,19 +550,477 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"def a = 1;\nfoobar;", "ERROR: 2:1: identifier not found: foobar"},
+		{"def f = func(x) {\n  ret x + true;\n};\nf(1);", "ERROR: 2:9: type mismatch: INTEGER + BOOLEAN"},
+		{"len(1, 2);", "ERROR: 1:4: wrong number of arguments. got=2, want=1"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Inspect() != test.expected {
+			t.Errorf("wrong error. got=%q, want=%q", errObj.Inspect(), test.expected)
+		}
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	input := `def inner = func(x) {
+  ret x / 0;
+};
+def outer = (x) => inner(x + 1);
+[1] |> map(func(v) { outer(v) });`
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	expected := []object.Frame{
+		{Function: "inner", Pos: token.Position{Line: 4, Column: 25}},
+		{Function: "outer", Pos: token.Position{Line: 5, Column: 27}},
+		{Function: "<anonymous>"},
+		{Function: "map", Pos: token.Position{Line: 5, Column: 11}},
+	}
+	if len(errObj.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. got=%d (%+v)", len(errObj.Trace), errObj.Trace)
+	}
+	for i, frame := range expected {
+		if errObj.Trace[i] != frame {
+			t.Errorf("trace[%d] wrong. got=%+v, want=%+v", i, errObj.Trace[i], frame)
+		}
+	}
+	traceback := `Traceback (most recent call last):
+  File "<stdin>", line 5, column 11, in <main>
+  in map
+  File "<stdin>", line 5, column 27, in <anonymous>
+  File "<stdin>", line 4, column 25, in outer
+  File "<stdin>", line 2, column 9, in inner
+ArithmeticError: division by zero: 2 / 0
+`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback. got=\n%s", errObj.Traceback())
+	}
+
+	evaluated = testEval("def f = func(n) { if (n == 0) { ret 1 + true; } ret 0 + f(n - 1); };\nf(10);")
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(errObj.Trace) != 11 {
+		t.Errorf("wrong trace length. got=%d", len(errObj.Trace))
+	}
+	traceback = `Traceback (most recent call last):
+  File "<stdin>", line 2, column 2, in <main>
+  File "<stdin>", line 1, column 58, in f
+  File "<stdin>", line 1, column 58, in f
+  File "<stdin>", line 1, column 58, in f
+  [Previous line repeated 7 more times]
+  File "<stdin>", line 1, column 39, in f
+TypeError: type mismatch: INTEGER + BOOLEAN
+`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback. got=\n%s", errObj.Traceback())
+	}
+
+	// Tail calls replace the caller's frame, keeping where the chain was entered.
+	evaluated = testEval("def g = func(n) { ret n + true; };\ndef f = func(n) { if (n == 0) { ret g(n); } ret f(n - 1); };\nf(10);")
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	traceback = `Traceback (most recent call last):
+  File "<stdin>", line 3, column 2, in <main>
+  File "<stdin>", line 1, column 25, in g
+TypeError: type mismatch: INTEGER + BOOLEAN
+`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback. got=\n%s", errObj.Traceback())
+	}
+
+	// An arity error is raised by the call, not inside the function called.
+	evaluated = testEval("def f = func(a){ a }; f();")
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	traceback = `Traceback (most recent call last):
+  File "<stdin>", line 1, column 24, in <main>
+ArgumentError: wrong number of arguments. got=0, want=1
+`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback. got=\n%s", errObj.Traceback())
+	}
+	evaluated = testEval("def g = func(a){ a };\ndef f = func(n) { ret g(); };\nf(1);")
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	traceback = `Traceback (most recent call last):
+  File "<stdin>", line 3, column 2, in <main>
+  File "<stdin>", line 2, column 24, in f
+ArgumentError: wrong number of arguments. got=0, want=1
+`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback. got=\n%s", errObj.Traceback())
+	}
+
+	if errObj := testEval("1 + true;").(*object.Error); len(errObj.Trace) != 0 {
+		t.Errorf("top level error has a trace: %+v", errObj.Trace)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 } catch { 2 }", "1"},
+		{"try { 1 / 0 } catch { 2 }", "2"},
+		{"try { 1 / 0 } catch (e) { e }", "ArithmeticError: division by zero: 1 / 0"},
+		{`try { 1 / 0 } catch (e) { e["kind"] }`, "ArithmeticError"},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero: 1 / 0"},
+		{`try { undefined } catch (e) { e["kind"] }`, "NameError"},
+		{`try { [1][5] = 0 } catch (e) { e["kind"] }`, "IndexError"},
+		{`try { len(1, 2) } catch (e) { e["kind"] }`, "ArgumentError"},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { def {a} = {} } catch (e) { e["kind"] }`, "KeyError"},
+		{`try { def [a, b] = [1] } catch (e) { e["kind"] }`, "IndexError"},
+		{`try { bigint("x") } catch (e) { e["kind"] }`, "ValueError"},
+		{`try { 1 << -1 } catch (e) { e["kind"] }`, "ArithmeticError"},
+		{`try { 5() } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { throw("boom") } catch (e) { [e["kind"], e["message"], e["value"]] }`, "[Error, boom, boom]"},
+		{`try { throw({"code": 4}, "HttpError") } catch (e) { [e["kind"], e["value"]["code"]] }`, "[HttpError, 4]"},
+		{`try { 1 / 0 } catch (e) { e["value"] }`, "null"},
+		{`try { 1 / 0 } catch (e) { e["nope"] }`, "null"},
+		{`def f = func() { 1 / 0 }; try { f() } catch (e) { def t = e["trace"]; [len(t), t[-1]["function"], t[-1]["position"]] }`, "[1, f, 1:34]"},
+		{`def log = ""; try { log = log + "t" } finally { log = log + "f" }; log`, "tf"},
+		{`def log = ""; try { 1 / 0 } catch { log = log + "c" } finally { log = log + "f" }; log`, "cf"},
+		{"def f = func() { try { ret 1 } finally { ret 2 } }; f()", "2"},
+		{"def f = func() { try { ret 1 } catch { ret 3 } }; f()", "1"},
+		{`try { try { 1 / 0 } catch (e) { throw(e) } } catch (e) { e["kind"] }`, "ArithmeticError"},
+		{`def g = func(e) { throw(e) }; try { 1 / 0 } catch (e) { try { g(e) } catch (again) { [len(e["trace"]), len(again["trace"]), again["position"]] } }`, "[0, 1, 1:39]"},
+		{`try { try { 1 / 0 } finally { 5 } } catch (e) { e["kind"] }`, "ArithmeticError"},
+		{`try { try { 1 / 0 } catch { throw("inner") } } catch (e) { e["message"] }`, "inner"},
+		{"def i = 0; while (i < 5) { try { if (i == 2) { break } } finally { i++ } }; i", "3"},
+		{"def i = 0; while (i < 5) { i++; def r = try { if (i == 2) { break; } 1 } catch { 0 }; }; i", "2"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated == nil || evaluated.Inspect() != test.expected {
+			t.Errorf("%s: got=%T (%+v), want %s", test.input, evaluated, evaluated, test.expected)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 / 0 } finally { 5 }", "division by zero: 1 / 0"},
+		{"try { 1 } finally { undefined }", "identifier not found: undefined"},
+		{"try { 1 / 0 } catch (e) { e[0] }", "index operator not supported: EXCEPTION"},
+		{`throw("a", 1)`, "second argument to `throw` must be STRING, got INTEGER"},
+		{"throw()", "wrong number of arguments. got=0, want=1 or 2"},
+	}
+	for _, test := range errTests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", test.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("%s: wrong error message. got=%q, want=%q", test.input, errObj.Message, test.expected)
+		}
+	}
+
+	// A rethrown error keeps the trace of where it was raised, without a
+	// frame for the call to throw.
+	evaluated := testEval("def inner = func() { 1 / 0 };\ndef f = func() { try { inner() } catch (e) { throw(e) } };\nf()")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	traceback := `Traceback (most recent call last):
+  File "<stdin>", line 3, column 2, in <main>
+  File "<stdin>", line 2, column 29, in f
+  File "<stdin>", line 1, column 24, in inner
+ArithmeticError: division by zero: 1 / 0
+`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback. got=\n%s", errObj.Traceback())
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	deadline, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stop()
+
+	tests := []struct {
+		input    string
+		opts     Options
+		expected string
+	}{
+		{"while (true) {}", Options{MaxSteps: 10000}, "step limit exceeded: 10000"},
+		{"while (true) {}", Options{Context: cancelled}, "evaluation stopped: context canceled"},
+		{"while (true) {}", Options{Context: deadline}, "evaluation stopped: context deadline exceeded"},
+		{"def f = func(n) { f(n + 1) }; f(0)", Options{MaxDepth: 100}, "call depth limit exceeded: 100"},
+		{"def f = func(n) { [n] |> map(f) }; f(0)", Options{MaxDepth: 50}, "call depth limit exceeded: 50"},
+		{`def s = "ab"; while (true) { s = s + s }`, Options{MaxAllocs: 1000}, "allocation limit exceeded: 1000"},
+		{`"x" * 1000000000`, Options{MaxAllocs: 1000}, "allocation limit exceeded: 1000"},
+		{`def s = "x"; s *= 1000000000`, Options{MaxAllocs: 1000}, "allocation limit exceeded: 1000"},
+		{"def a = []; while (true) { a = [a, a, a] }", Options{MaxAllocs: 300}, "allocation limit exceeded: 300"},
+		{"try { while (true) {} } catch { 1 } finally { 2 }", Options{MaxSteps: 100}, "step limit exceeded: 100"},
+	}
+	for _, test := range tests {
+		program := parser.NewParser(lexer.NewLexer(test.input)).Parse()
+		evaluated := EvalWithOptions(program, object.NewEnvironment(), test.opts)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", test.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Kind != object.LIMIT_ERROR || errObj.Message != test.expected {
+			t.Errorf("%s: wrong error. got=%s: %q, want=%s: %q", test.input, errObj.Kind, errObj.Message, object.LIMIT_ERROR, test.expected)
+		}
+	}
+
+	// Limits apply to one evaluation only and are lifted once it returns.
+	env := object.NewEnvironment()
+	program := parser.NewParser(lexer.NewLexer("def f = func(n) { if (n == 0) { ret 0 } ret 0 + f(n - 1) }; f(20)")).Parse()
+	if evaluated := EvalWithOptions(program, env, Options{MaxDepth: 30, MaxSteps: 1000}); evaluated.Inspect() != "0" {
+		t.Errorf("within limits: got=%T (%+v)", evaluated, evaluated)
+	}
+	if env.Budget() != nil {
+		t.Errorf("budget left on the environment after the evaluation")
+	}
+	program = parser.NewParser(lexer.NewLexer("f(50)")).Parse()
+	if evaluated := EvalWithOptions(program, env, Options{MaxDepth: 30}); !isLimitError(evaluated) {
+		t.Errorf("closure from an earlier evaluation escaped the limit: got=%T (%+v)", evaluated, evaluated)
+	}
+	if evaluated := Eval(program, env); evaluated.Inspect() != "0" {
+		t.Errorf("without limits: got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def count = func(n, acc) { if (n == 0) { ret acc } ret count(n - 1, acc + 1) }; count(1000000, 0)", "1000000"},
+		{`def even = func(n) { if (n == 0) { ret true } ret odd(n - 1) };
+def odd = func(n) { if (n == 0) { ret false } ret even(n - 1) };
+even(1000001)`, "false"},
+		{"def loop = (n) => { if (n > 0) { ret loop(n - 1) } ret len(\"done\") }; loop(1000000)", "4"},
+		{"def f = func(n) { ret n * 2 }; ret f(21)", "42"},
+		{"def f = func() { ret f }; f()()() == f", "true"},
+		{`def f = func(n) { try { ret g(n) } catch (e) { ret e["kind"] } };
+def g = func(n) { ret n / 0 };
+f(1)`, "ArithmeticError"},
+		{`def log = ""; def g = func() { log = log + "g" };
+def f = func() { try { ret g() } finally { log = log + "f" } };
+f(); log`, "gf"},
+		{"def f = func(n) { if (n == 0) { ret 0 } ret 0 + f(n - 1) }; f(1000)", "0"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated == nil || evaluated.Inspect() != test.expected {
+			t.Errorf("%s: got=%T (%+v), want %s", test.input, evaluated, evaluated, test.expected)
+		}
+	}
+
+	// Each tail call still counts against the depth limit, but only while it runs.
+	program := parser.NewParser(lexer.NewLexer("def f = func(n) { if (n == 0) { ret 0 } ret f(n - 1) }; f(100000)")).Parse()
+	if evaluated := EvalWithOptions(program, object.NewEnvironment(), Options{MaxDepth: 10}); evaluated.Inspect() != "0" {
+		t.Errorf("tail calls exceeded the depth limit: got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
 func TestDefineAndAssignStatement(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected float64
+		expected int64
+	}{
+		{"def a=5;a;", 5},
+		{"def a=5*5;a;", 25},
+		{"def a=5;def b=a;b;", 5},
+		{"def a=5;def b=a;def c=a+b+5;c;", 15},
+		{"def a=5;a=5*5;a;", 25},
+	}
+	for _, test := range tests {
+		testIntegerObj(t, testEval(test.input), test.expected)
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"def a=5;a+=3;a;", 8},
+		{"def a=5;a-=7;a;", -2},
+		{"def a=5;a*=2+1;a;", 15},
+		{"def a=17;a/=5;a;", 3},
+		{"def a=17;a%=5;a;", 2},
+		{"def a=3;a<<=2;a;", 12},
+		{"def a=12;a>>=1;a;", 6},
+		{"def s=0;def i=0;while(i<5){s+=i;i+=1;}s;", 10},
+	}
+	for _, test := range tests {
+		testIntegerObj(t, testEval(test.input), test.expected)
+	}
+}
+
+func TestBumpOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"def a=5;++a;", 6},
+		{"def a=5;++a;a;", 6},
+		{"def a=5;--a;a;", 4},
+		{"def a=5;a++;", 5},
+		{"def a=5;a++;a;", 6},
+		{"def a=5;a--;a;", 4},
+		{"def a=5;a++ + a;", 11},
+		{"def a=5;++a + a;", 12},
+		{"def a=5;-a++;", -5},
+		{"++5;", 6},
+		{"for(def i=0;i<4;i++){if(i==3){ret i*10;}}", 30},
+	}
+	for _, test := range tests {
+		testIntegerObj(t, testEval(test.input), test.expected)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"b++;", "identifier not found: b"},
+		{`def s="a";s++;`, "unknown operator: ++STRING"},
+		{`def s="a";s+=1;`, "unknown operator: STRING + INTEGER"},
+		{"c+=1;", "identifier not found: c"},
+	}
+	for _, test := range errTests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", test.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, test.expected)
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"def a=[1,2,3];a[0]=5;a[0];", 5},
+		{"def a=[1,2,3];a[-1]=7;a[2];", 7},
+		{`def h={"k":1};h["k"]=2;h["k"];`, 2},
+		{`def h={};h["n"]=3;h["n"];`, 3},
+		{`def a=[1,{"x":1}];a[1]["x"]=2;a[1]["x"];`, 2},
+		{"def m=[[1,2],[3,4]];m[1][0]=9;m[1][0];", 9},
+		{"def a=[1,2];def b=a;b[0]=8;a[0];", 8},
+		{"def a=[1,2];a[1]+=10;a[1];", 12},
+		{"def a=[1,2];a[0]++;", 1},
+		{"def a=[1,2];a[0]++;a[0];", 2},
+		{"def a=[1,2];++a[1];", 3},
+		{`def h={"c":0};h["c"]+=1;h["c"]+=1;h["c"];`, 2},
+		{`def c={"n":0};def f=func(){c["n"]+=1;ret 0;};def a=[5];a[f()]+=1;c["n"]*10+a[0];`, 16},
+		{"def a=[1,2];def set=func(arr){arr[0]=4;};set(a);a[0];", 4},
+	}
+	for _, test := range tests {
+		testIntegerObj(t, testEval(test.input), test.expected)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"def a=[1,2];a[2]=1;", "index out of range: 2 (length 2)"},
+		{"def a=[1,2];a[-3]=1;", "index out of range: -3 (length 2)"},
+		{"def a=[1,2];a[5]+=1;", "index out of range: 5 (length 2)"},
+		{`def a=[1,2];a["x"]=1;`, "array index must be INTEGER, got STRING"},
+		{"def h={};h[[1]]=1;", "unusable as hash key: ARRAY"},
+		{`def s="abc";s[0]="x";`, "index assignment not supported: STRING"},
+		{"b[0]=1;", "identifier not found: b"},
+	}
+	for _, test := range errTests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", test.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, test.expected)
+		}
+	}
+}
+
+func TestClosureAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"def n=0;def inc=func(){n=n+1;};inc();inc();n;", 2},
+		{"def counter=func(){def c=0;ret func(){c+=1;ret c;};};def next=counter();next();next();next();", 3},
+		{"def counter=func(){def c=0;ret func(){ret ++c;};};def a=counter();def b=counter();a();a();b();a();", 3},
+		{"def sum=0;def add=func(x){sum+=x;};add(3);add(4);sum;", 7},
+		{"def n=0;def f=func(){def g=func(){n++;};g();g();};f();n;", 2},
+		{"def n=1;def f=func(){def n=10;n=n+1;ret n;};f()*100+n;", 1101},
+		{"def n=1;def f=func(n){n=n+5;ret n;};f(2)*100+n;", 701},
+		{"def n=0;for(def i=0;i<4;i++){n+=i;}n;", 6},
+		{"def s=0;def i=0;while(i<3){def j=i;s+=j;i++;}s;", 3},
+	}
+	for _, test := range tests {
+		testIntegerObj(t, testEval(test.input), test.expected)
+	}
+
+	evaluated := testEval("def f=func(){undefined=1;};f();")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: undefined" {
+		t.Errorf("expected identifier not found error, got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
 	}{
-		{"def a=5;a;", 5.0},
-		{"def a=5*5;a;", 25.0},
-		{"def a=5;def b=a;b;", 5.0},
-		{"def a=5;def b=a;def c=a+b+5;c;", 15.0},
-		{"def a=5;a=5*5;a;", 25.0},
+		{`len("héllo")`, 6},
+		{`runeLen("héllo")`, 5},
+		{`def 名字 = "世界"; runeLen(名字);`, 2},
+		{`def café = 3; café * 2;`, 6},
 	}
 	for _, test := range tests {
-		testDecimalObj(t, testEval(test.input), test.expected)
+		testIntegerObj(t, testEval(test.input), test.expected)
+	}
+	evaluated := testEval(`def 问候 = "你好, "; 问候 + "世界"`)
+	str, ok := evaluated.(*object.String)
+	if !ok || str.Value != "你好, 世界" {
+		t.Errorf("wrong string. got=%T (%+v)", evaluated, evaluated)
+	}
+	evaluated = testEval(`runeLen(1)`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "argument to `runeLen` must be STRING, got INTEGER" {
+		t.Errorf("wrong error. got=%T (%+v)", evaluated, evaluated)
 	}
 }
 
@@ -175,6 +1042,182 @@ func TestFunctionObj(t *testing.T) {
 	}
 }
 
+func TestArrowAndParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def add=(a, b) => a + b;add(2, 3)", "5"},
+		{"(() => 42)()", "42"},
+		{"((x) => x * x)(7)", "49"},
+		{"def f=(x) => { def y = x + 1; y * 2 };f(4)", "10"},
+		{"[1, 2, 3] |> map((x) => x * 10)", "[10, 20, 30]"},
+		{"def mk=(n) => (x) => x + n;mk(3)(4)", "7"},
+		{"def f=func(a, b = 10){ret a + b;};f(1)", "11"},
+		{"def f=func(a, b = 10){ret a + b;};f(1, 2)", "3"},
+		{"def f=func(a, b = a * 2){ret b;};f(4)", "8"},
+		{"def f=(a, b = 1, c = b + 1) => [a, b, c];f(0)", "[0, 1, 2]"},
+		{"def f=func(first, ...rest){ret rest;};f(1, 2, 3)", "[2, 3]"},
+		{"def f=func(first, ...rest){ret rest;};f(1)", "[]"},
+		{"def f=(...xs) => len(xs);f()", "0"},
+		{"def f=(a = 1, ...xs) => [a, xs];f(5, 6)", "[5, [6]]"},
+		{"def f=func(x = 2){ret x;};f", "func(x = 2) {\n{ret x;}\n}"},
+		{"(1 + 2) * 3", "9"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated == nil || evaluated.Inspect() != test.expected {
+			t.Errorf("%s: got=%T (%+v), want %s", test.input, evaluated, evaluated, test.expected)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"def f=func(a, b){ret a;};f(1)", "wrong number of arguments. got=1, want=2"},
+		{"def f=func(a){ret a;};f(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"def f=func(a, b = 1){ret a;};f()", "wrong number of arguments. got=0, want=1..2"},
+		{"def f=func(a, ...r){ret a;};f()", "wrong number of arguments. got=0, want=1+"},
+		{"def f=func(a = undefined){ret a;};f()", "identifier not found: undefined"},
+		{"[1, 2] |> map((a, b) => a)", "wrong number of arguments. got=1, want=2"},
+	}
+	for _, test := range errTests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", test.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, test.expected)
+		}
+	}
+}
+
+func TestDestructuringDefinition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def [a, b] = [1, 2];a * 10 + b", "12"},
+		{"def [a, ...rest] = [1, 2, 3];rest", "[2, 3]"},
+		{"def [a, ...rest] = [1];rest", "[]"},
+		{"def [a, b = 5] = [1];a + b", "6"},
+		{"def [a, b = a * 3] = [2];b", "6"},
+		{"def [_, b] = [1, 2];b", "2"},
+		{"def [a, [b, c]] = [1, [2, 3]];a + b + c", "6"},
+		{`def {name, age: years} = {"name": "ann", "age": 31};years + len(name)`, "34"},
+		{`def {x, y = 0} = {"x": 4};x + y`, "4"},
+		{`def {"first-name": first} = {"first-name": "bo"};first`, "bo"},
+		{`def {pos: [x, y]} = {"pos": [3, 4], "extra": true};x * y`, "12"},
+		{`def [{id}] = [{"id": 7}];id`, "7"},
+		{"def f=func(){def [a, b] = [1, 2];ret a + b;};f()", "3"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated == nil || evaluated.Inspect() != test.expected {
+			t.Errorf("%s: got=%T (%+v), want %s", test.input, evaluated, evaluated, test.expected)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"def [a, b] = [1];", "not enough elements to destructure: got 1, want 2"},
+		{"def [a] = [1, 2];", "too many elements to destructure: got 2, want 1"},
+		{"def [a, b] = 5;", "cannot destructure INTEGER as an array: [a, b]"},
+		{`def {a} = [1];`, "cannot destructure ARRAY as a hash: {a}"},
+		{`def {name, age} = {"name": "ann"};`, `missing key "age" to destructure`},
+		{"def [a = undefined] = [];", "identifier not found: undefined"},
+	}
+	for _, test := range errTests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", test.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, test.expected)
+		}
+	}
+}
+
+func TestLoopStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"def i=0;while(i<5){i=i+1;}i;", 5},
+		{"def s=0;def i=0;while(i<5){s=s+i;i=i+1;}s;", 10},
+		{"def i=10;while(i<5){i=i+1;}i;", 10},
+		{"while(false){1;}", nil},
+		{"for(def i=0;i<5;i=i+1){i;}", nil},
+		{"def f=func(){for(def i=0;i<10;i=i+1){if(i*i>20){ret i;}}ret -1;};f();", 5},
+		{"def f=func(n){for(def i=0;i<n;i=i+1){}ret n;};f(3);", 3},
+		{"def s=0;def i=0;while(i<3){def j=0;while(j<4){s=s+1;j=j+1;}i=i+1;}s;", 12},
+		{"def f=func(){for(def i=0;i<3;i=i+1){for(def j=0;j<3;j=j+1){if(i*j==2){ret i*10+j;}}}};f();", 12},
+		{"def f=func(){def i=0;while(true){if(i==7){ret i;}i=i+1;}};f();", 7},
+		{"for(def i=0;i<3;i=i+1){ret i+100;}", 100},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		integer, ok := test.expected.(int)
+		if ok {
+			testIntegerObj(t, evaluated, int64(integer))
+		} else {
+			testNullObj(t, evaluated)
+		}
+	}
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"def i=0;while(true){if(i==3){break;}i=i+1;}i;", 3},
+		{"def s=0;def i=0;while(i<5){i=i+1;if(i==2){continue;}s=s+i;}s;", 13},
+		{"def f=func(){for(def i=0;i<10;i=i+1){if(i<3){continue;}ret i;}};f();", 3},
+		{"def f=func(){for(def i=0;i<10;i=i+1){if(i==4){break;}ret i;}ret 9;};f();", 0},
+		{"def f=func(){for(def i=0;true;i=i+1){if(i==4){break;}}ret 9;};f();", 9},
+		{"for(def i=0;i<3;i=i+1){for(def j=0;j<3;j=j+1){if(j==1){break;}}if(i==2){ret i*10;}}", 20},
+		{"def s=0;def i=0;while(i<3){i=i+1;def j=0;while(true){j=j+1;if(j<3){continue;}break;}s=s+j;}s;", 9},
+		{"def s=0;def i=0;while(i<3){i=i+1;def r=if(i==2){continue;};s=s+i;}s;", 4},
+		{"def id=func(x){x};def i=0;while(i<10){i=i+1;id(if(i==3){break;}else{i});}i;", 3},
+		{"def i=0;while(i<10){i=i+1;def r=[1, 2 + if(i==3){break;}else{0}];}i;", 3},
+	}
+	for _, test := range tests {
+		testIntegerObj(t, testEval(test.input), test.expected)
+	}
+}
+
+func TestLoopErrorHandling(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for(def i=0;i<3;i=i+1){}i;", "identifier not found: i"},
+		{"while(foo){}", "identifier not found: foo"},
+		{"def i=0;while(i<3){i=i+true;}", "type mismatch: INTEGER + BOOLEAN"},
+		{"for(def i=0;i<3;i=i+true){}", "type mismatch: INTEGER + BOOLEAN"},
+		{"for(def i=bar;i<3;i=i+1){}", "identifier not found: bar"},
+	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != test.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, test.expected)
+		}
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.NewLexer(input)
 	p := parser.NewParser(l)
@@ -183,6 +1226,19 @@ func testEval(input string) object.Object {
 	return Eval(pro, env)
 }
 
+func testIntegerObj(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testDecimalObj(t *testing.T, obj object.Object, expected float64) bool {
 	result, ok := obj.(*object.Decimal)
 	if !ok {
@@ -0,0 +1,143 @@
+package monkey_evaluator
+
+import (
+	"context"
+	"math"
+	ast "myMonkey/monkey_ast"
+	object "myMonkey/monkey_object"
+)
+
+// Options limits the resources a single evaluation may use. A zero field means
+// no limit.
+type Options struct {
+	// Context stops the evaluation once it is cancelled or its deadline passes.
+	Context context.Context
+	// MaxSteps is the number of AST nodes that may be evaluated.
+	MaxSteps int
+	// MaxDepth is how deeply function calls may nest.
+	MaxDepth int
+	// MaxAllocs is the total size of the strings (in bytes), arrays and hashes
+	// (in elements) the evaluation may create.
+	MaxAllocs int
+}
+
+// contextCheckInterval is how many steps pass between two checks of the
+// context, which is too expensive to check on every node.
+const contextCheckInterval = 1024
+
+// EvalWithOptions evaluates node like Eval, but returns an error of kind
+// object.LIMIT_ERROR as soon as one of the limits in opts is exceeded.
+func EvalWithOptions(node ast.Node, env *object.Environment, opts Options) object.Object {
+	defer withBudget(env, opts)()
+	return Eval(node, env)
+}
+
+// ApplyWithOptions is Apply under the limits in opts. env is the environment
+// fn belongs to, which carries the budget.
+func ApplyWithOptions(fn object.Object, args []object.Object, env *object.Environment, opts Options) object.Object {
+	defer withBudget(env, opts)()
+	return Apply(fn, args)
+}
+
+// withBudget gives env a fresh budget for opts and returns the function that
+// puts back the previous one.
+func withBudget(env *object.Environment, opts Options) func() {
+	prev := env.Budget()
+	env.SetBudget(&object.Budget{
+		Context:   opts.Context,
+		MaxSteps:  opts.MaxSteps,
+		MaxDepth:  opts.MaxDepth,
+		MaxAllocs: opts.MaxAllocs,
+	})
+	return func() { env.SetBudget(prev) }
+}
+
+func newLimitError(format string, a ...interface{}) *object.Error {
+	return newKindError(object.LIMIT_ERROR, format, a...)
+}
+
+func isLimitError(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && err.Kind == object.LIMIT_ERROR
+}
+
+// chargeStep counts the evaluation of one node. It returns a limit error, or
+// nil if the evaluation may go on.
+func chargeStep(b *object.Budget) object.Object {
+	if b == nil {
+		return nil
+	}
+	b.Steps++
+	if b.MaxSteps > 0 && b.Steps > b.MaxSteps {
+		return newLimitError("step limit exceeded: %d", b.MaxSteps)
+	}
+	if b.Context != nil && b.Steps%contextCheckInterval == 0 {
+		if err := b.Context.Err(); err != nil {
+			return newLimitError("evaluation stopped: %v", err)
+		}
+	}
+	return nil
+}
+
+// enterCall counts a function call; every successful call must be paired with
+// leaveCall.
+func enterCall(b *object.Budget) object.Object {
+	if b == nil {
+		return nil
+	}
+	if b.MaxDepth > 0 && b.Depth >= b.MaxDepth {
+		return newLimitError("call depth limit exceeded: %d", b.MaxDepth)
+	}
+	b.Depth++
+	return nil
+}
+
+func leaveCall(b *object.Budget) {
+	if b != nil {
+		b.Depth--
+	}
+}
+
+// chargeAlloc counts the creation of a value of the given size.
+func chargeAlloc(b *object.Budget, size int) object.Object {
+	if b == nil {
+		return nil
+	}
+	b.Allocs += size
+	if b.MaxAllocs > 0 && b.Allocs > b.MaxAllocs {
+		return newLimitError("allocation limit exceeded: %d", b.MaxAllocs)
+	}
+	return nil
+}
+
+// sizeOf is the size chargeAlloc counts for obj.
+func sizeOf(obj object.Object) int {
+	switch obj := obj.(type) {
+	case *object.String:
+		return len(obj.Value)
+	case *object.Array:
+		return len(obj.Value)
+	case *object.Hash:
+		return len(obj.Pairs)
+	}
+	return 0
+}
+
+// infixSize is the size of the value op will create from left and right. It
+// is charged before the operation runs, so that "x" * 1000000000 fails
+// without building the string first.
+func infixSize(op string, left, right object.Object) int {
+	l, ok := left.(*object.String)
+	if !ok {
+		return 0
+	}
+	switch {
+	case op == "*" && isNumeric(right):
+		if n := float64(len(l.Value)) * toFloat(right); n > 0 {
+			return int(math.Min(n, math.MaxInt32))
+		}
+	case op == "+":
+		return len(l.Value) + sizeOf(right)
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package monkey_evaluator
+
+import (
+	ast "myMonkey/monkey_ast"
+	object "myMonkey/monkey_object"
+)
+
+// evalMatch tries the arms of a match expression in order. Each arm gets its
+// own scope for the variables bound by its pattern, which its guard and body
+// can see. If no arm matches the result is NULL.
+func evalMatch(node *ast.MatchExpression, env *object.Environment) object.Object {
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+	for _, arm := range node.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+		matched, err := matchPattern(arm.Pattern, value, armEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTrue(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Body, armEnv)
+	}
+	return NULL
+}
+
+// matchPattern reports whether value matches pattern, binding the variables
+// of the pattern in env as it goes. The second result is an error object if
+// evaluating part of the pattern failed.
+func matchPattern(pattern ast.Expression, value object.Object, env *object.Environment) (bool, object.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			env.Set(pattern.Value, value)
+		}
+		return true, nil
+	case *ast.PinExpression:
+		pinned := Eval(pattern.Name, env)
+		if isAbrupt(pinned) {
+			return false, pinned
+		}
+		return objectsEqual(pinned, value), nil
+	case *ast.ArrayLiteral:
+		array, ok := value.(*object.Array)
+		if !ok || len(array.Value) != len(pattern.Value) {
+			return false, nil
+		}
+		for i, elem := range pattern.Value {
+			if matched, err := matchPattern(elem, array.Value[i], env); !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case *ast.HashLiteral:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+		// in source order, so that a key can use a variable bound before it
+		for _, kNode := range pattern.Keys {
+			vNode := pattern.Pairs[kNode]
+			k := Eval(kNode, env)
+			if isAbrupt(k) {
+				return false, k
+			}
+			hashKey, ok := k.(object.HashAble)
+			if !ok {
+				return false, newKindError(object.TYPE_ERROR, "unusable as hash key: %s", k.Type())
+			}
+			pair, ok := hash.Pairs[hashKey.HashKey()]
+			if !ok {
+				return false, nil
+			}
+			if matched, err := matchPattern(vNode, pair.Value, env); !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		expected := Eval(pattern, env)
+		if expected == nil || isError(expected) {
+			return false, expected
+		}
+		return objectsEqual(expected, value), nil
+	}
+}
+
+// objectsEqual compares numbers by value across the numeric types, strings by
+// content and everything else by identity.
+func objectsEqual(a, b object.Object) bool {
+	switch {
+	case isNumeric(a) && isNumeric(b):
+		return evalNumberInfix("==", a, b) == TRUE
+	case a.Type() == object.STRING_OBJ && b.Type() == object.STRING_OBJ:
+		return a.(*object.String).Value == b.(*object.String).Value
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,379 @@
+package monkey_evaluator
+
+import (
+	"math"
+	"math/big"
+	object "myMonkey/monkey_object"
+	"strconv"
+)
+
+// maxShift bounds shift counts on big integers so that a typo cannot make the
+// interpreter allocate gigabytes.
+const maxShift = 1 << 20
+
+// numberRank orders the numeric types from most to least exact. Mixed
+// arithmetic promotes both operands to the type of the higher rank.
+func numberRank(obj object.Object) int {
+	switch obj.Type() {
+	case object.INTEGER_OBJ:
+		return 1
+	case object.BIGINT_OBJ:
+		return 2
+	case object.RATIONAL_OBJ:
+		return 3
+	case object.DECIMAL_OBJ:
+		return 4
+	default:
+		return 0
+	}
+}
+
+func isNumeric(obj object.Object) bool {
+	return numberRank(obj) > 0
+}
+
+// isIntegral reports whether obj is one of the integer types, the only
+// operands accepted by the bitwise and shift operators.
+func isIntegral(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIGINT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	case *object.Rational:
+		f, _ := obj.Value.Float64()
+		return f
+	case *object.Decimal:
+		return obj.Value
+	default:
+		return math.NaN()
+	}
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInt:
+		return obj.Value
+	default:
+		return nil
+	}
+}
+
+func toRational(obj object.Object) *big.Rat {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return new(big.Rat).SetInt64(obj.Value)
+	case *object.BigInt:
+		return new(big.Rat).SetInt(obj.Value)
+	case *object.Rational:
+		return obj.Value
+	case *object.Decimal:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return nil
+		}
+		r, _ := new(big.Rat).SetString(strconv.FormatFloat(obj.Value, 'g', -1, 64))
+		return r
+	default:
+		return nil
+	}
+}
+
+// normalizeBigInt demotes results that fit into an int64 back to Integer.
+func normalizeBigInt(value *big.Int) object.Object {
+	if value.IsInt64() {
+		return &object.Integer{Value: value.Int64()}
+	}
+	return &object.BigInt{Value: value}
+}
+
+// evalNumberInfix applies op to two numbers. Integers stay integers and are
+// promoted to BigInt when the result overflows, Rational is used once one
+// side is exact but fractional, and as soon as one side is a Decimal both
+// sides are promoted to Decimal.
+func evalNumberInfix(op string, left, right object.Object) object.Object {
+	switch op {
+	case "&", "|", "^", "<<", ">>":
+		if !isIntegral(left) || !isIntegral(right) {
+			return newKindError(object.TYPE_ERROR, "non-integral operand: %s %s %s", left.Type(), op, right.Type())
+		}
+	case "**":
+		return evalPower(left, right)
+	case "~/":
+		return evalFloorDivide(left, right)
+	}
+	switch max(numberRank(left), numberRank(right)) {
+	case 1:
+		return evalIntegerInfix(op, left.(*object.Integer).Value, right.(*object.Integer).Value)
+	case 2:
+		return evalBigIntInfix(op, toBigInt(left), toBigInt(right))
+	case 3:
+		return evalRationalInfix(op, toRational(left), toRational(right))
+	default:
+		return evalDecimalInfix(op, left, right)
+	}
+}
+
+func evalIntegerInfix(op string, left, right int64) object.Object {
+	switch op {
+	case "+":
+		result := left + right
+		if (left > 0 && right > 0 && result < 0) || (left < 0 && right < 0 && result >= 0) {
+			return evalBigIntInfix(op, big.NewInt(left), big.NewInt(right))
+		}
+		return &object.Integer{Value: result}
+	case "-":
+		result := left - right
+		if (left >= 0 && right < 0 && result < 0) || (left < 0 && right > 0 && result >= 0) {
+			return evalBigIntInfix(op, big.NewInt(left), big.NewInt(right))
+		}
+		return &object.Integer{Value: result}
+	case "*":
+		if left == 0 || right == 0 {
+			return &object.Integer{Value: 0}
+		}
+		result := left * right
+		if result/right != left || (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64) {
+			return evalBigIntInfix(op, big.NewInt(left), big.NewInt(right))
+		}
+		return &object.Integer{Value: result}
+	case "/", "%":
+		if right == 0 {
+			return newKindError(object.ARITHMETIC_ERROR, "division by zero: %d %s %d", left, op, right)
+		}
+		if left == math.MinInt64 && right == -1 {
+			return evalBigIntInfix(op, big.NewInt(left), big.NewInt(right))
+		}
+		if op == "%" {
+			return &object.Integer{Value: left % right}
+		}
+		return &object.Integer{Value: left / right}
+	case "<<":
+		if right < 0 {
+			return newKindError(object.ARITHMETIC_ERROR, "negative shift count: %d << %d", left, right)
+		}
+		if right >= 64 || (left<<right)>>right != left {
+			return evalBigIntInfix(op, big.NewInt(left), big.NewInt(right))
+		}
+		return &object.Integer{Value: left << right}
+	case ">>":
+		if right < 0 {
+			return newKindError(object.ARITHMETIC_ERROR, "negative shift count: %d >> %d", left, right)
+		}
+		return &object.Integer{Value: left >> uint64(right)}
+	case "&":
+		return &object.Integer{Value: left & right}
+	case "|":
+		return &object.Integer{Value: left | right}
+	case "^":
+		return &object.Integer{Value: left ^ right}
+	case "<":
+		return convertBoolean(left < right)
+	case ">":
+		return convertBoolean(left > right)
+	case "==":
+		return convertBoolean(left == right)
+	case "!=":
+		return convertBoolean(left != right)
+	case ">=":
+		return convertBoolean(left >= right)
+	case "<=":
+		return convertBoolean(left <= right)
+	default:
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s", object.INTEGER_OBJ, op, object.INTEGER_OBJ)
+	}
+}
+
+func evalBigIntInfix(op string, left, right *big.Int) object.Object {
+	result := new(big.Int)
+	switch op {
+	case "+":
+		return normalizeBigInt(result.Add(left, right))
+	case "-":
+		return normalizeBigInt(result.Sub(left, right))
+	case "*":
+		return normalizeBigInt(result.Mul(left, right))
+	case "/", "%":
+		if right.Sign() == 0 {
+			return newKindError(object.ARITHMETIC_ERROR, "division by zero: %s %s %s", left, op, right)
+		}
+		if op == "%" {
+			return normalizeBigInt(result.Rem(left, right))
+		}
+		return normalizeBigInt(result.Quo(left, right))
+	case "<<", ">>":
+		if right.Sign() < 0 {
+			return newKindError(object.ARITHMETIC_ERROR, "negative shift count: %s %s %s", left, op, right)
+		}
+		if !right.IsInt64() || right.Int64() > maxShift {
+			return newKindError(object.ARITHMETIC_ERROR, "shift count too large: %s %s %s", left, op, right)
+		}
+		if op == "<<" {
+			return normalizeBigInt(result.Lsh(left, uint(right.Int64())))
+		}
+		return normalizeBigInt(result.Rsh(left, uint(right.Int64())))
+	case "&":
+		return normalizeBigInt(result.And(left, right))
+	case "|":
+		return normalizeBigInt(result.Or(left, right))
+	case "^":
+		return normalizeBigInt(result.Xor(left, right))
+	case "<", ">", "==", "!=", ">=", "<=":
+		return compareResult(op, left.Cmp(right))
+	default:
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s", object.BIGINT_OBJ, op, object.BIGINT_OBJ)
+	}
+}
+
+func evalRationalInfix(op string, left, right *big.Rat) object.Object {
+	result := new(big.Rat)
+	switch op {
+	case "+":
+		return &object.Rational{Value: result.Add(left, right)}
+	case "-":
+		return &object.Rational{Value: result.Sub(left, right)}
+	case "*":
+		return &object.Rational{Value: result.Mul(left, right)}
+	case "/":
+		if right.Sign() == 0 {
+			return newKindError(object.ARITHMETIC_ERROR, "division by zero: %s %s %s", left.RatString(), op, right.RatString())
+		}
+		return &object.Rational{Value: result.Quo(left, right)}
+	case "%":
+		if right.Sign() == 0 {
+			return newKindError(object.ARITHMETIC_ERROR, "division by zero: %s %s %s", left.RatString(), op, right.RatString())
+		}
+		quo := result.Quo(left, right)
+		trunc := new(big.Rat).SetInt(new(big.Int).Quo(quo.Num(), quo.Denom()))
+		return &object.Rational{Value: result.Sub(left, trunc.Mul(trunc, right))}
+	case "<", ">", "==", "!=", ">=", "<=":
+		return compareResult(op, left.Cmp(right))
+	default:
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s", object.RATIONAL_OBJ, op, object.RATIONAL_OBJ)
+	}
+}
+
+// evalPower raises base to exp. Exact bases with an integral exponent give
+// exact results, so a negative exponent on an integer yields a Rational;
+// everything else is computed on Decimals.
+func evalPower(base, exp object.Object) object.Object {
+	e := toBigInt(exp)
+	if r, ok := exp.(*object.Rational); ok && r.Value.IsInt() {
+		e = r.Value.Num()
+	}
+	if e == nil || base.Type() == object.DECIMAL_OBJ {
+		return &object.Decimal{Value: math.Pow(toFloat(base), toFloat(exp))}
+	}
+	r := toRational(base)
+	if r.Sign() == 0 && e.Sign() < 0 {
+		return newKindError(object.ARITHMETIC_ERROR, "division by zero: %s ** %s", base.Inspect(), exp.Inspect())
+	}
+	abs := new(big.Int).Abs(e)
+	num, ok := powBigInt(r.Num(), abs)
+	if !ok {
+		return newKindError(object.ARITHMETIC_ERROR, "exponent too large: %s ** %s", base.Inspect(), exp.Inspect())
+	}
+	den, ok := powBigInt(r.Denom(), abs)
+	if !ok {
+		return newKindError(object.ARITHMETIC_ERROR, "exponent too large: %s ** %s", base.Inspect(), exp.Inspect())
+	}
+	result := new(big.Rat).SetFrac(num, den)
+	if e.Sign() < 0 {
+		result.Inv(result)
+	}
+	if result.IsInt() && base.Type() != object.RATIONAL_OBJ {
+		return normalizeBigInt(result.Num())
+	}
+	return &object.Rational{Value: result}
+}
+
+// powBigInt computes x**e for a non-negative e, refusing results that would
+// be larger than maxShift bits.
+func powBigInt(x, e *big.Int) (*big.Int, bool) {
+	if bits := x.BitLen(); bits > 1 && (!e.IsInt64() || e.Int64() > maxShift || int64(bits-1)*e.Int64() > maxShift) {
+		return nil, false
+	}
+	return new(big.Int).Exp(x, e, nil), true
+}
+
+// evalFloorDivide implements ~/, which divides and rounds towards negative
+// infinity. The result is always an integer, whatever the operand types.
+// Integer / instead truncates towards zero, as in Go, and % takes the sign of
+// the dividend to match it; the two only differ for negative quotients.
+func evalFloorDivide(left, right object.Object) object.Object {
+	if numberRank(left) == 4 || numberRank(right) == 4 {
+		l, r := toFloat(left), toFloat(right)
+		if r == 0 {
+			return newKindError(object.ARITHMETIC_ERROR, "division by zero: %s ~/ %s", left.Inspect(), right.Inspect())
+		}
+		quo := math.Floor(l / r)
+		if math.IsInf(quo, 0) || math.IsNaN(quo) {
+			return newKindError(object.ARITHMETIC_ERROR, "result is not a finite number: %s ~/ %s", left.Inspect(), right.Inspect())
+		}
+		value, _ := big.NewFloat(quo).Int(nil)
+		return normalizeBigInt(value)
+	}
+	l, r := toRational(left), toRational(right)
+	if r.Sign() == 0 {
+		return newKindError(object.ARITHMETIC_ERROR, "division by zero: %s ~/ %s", left.Inspect(), right.Inspect())
+	}
+	quo := new(big.Rat).Quo(l, r)
+	// The denominator of a big.Rat is always positive, so Euclidean division
+	// of the numerator rounds towards negative infinity.
+	return normalizeBigInt(new(big.Int).Div(quo.Num(), quo.Denom()))
+}
+
+// compareResult turns the result of a Cmp call into the boolean for op.
+func compareResult(op string, cmp int) object.Object {
+	switch op {
+	case "<":
+		return convertBoolean(cmp < 0)
+	case ">":
+		return convertBoolean(cmp > 0)
+	case "==":
+		return convertBoolean(cmp == 0)
+	case "!=":
+		return convertBoolean(cmp != 0)
+	case ">=":
+		return convertBoolean(cmp >= 0)
+	default:
+		return convertBoolean(cmp <= 0)
+	}
+}
+
+func evalDecimalInfix(op string, leftObj, rightObj object.Object) object.Object {
+	left := toFloat(leftObj)
+	right := toFloat(rightObj)
+	switch op {
+	case "+":
+		return &object.Decimal{Value: left + right}
+	case "-":
+		return &object.Decimal{Value: left - right}
+	case "*":
+		return &object.Decimal{Value: left * right}
+	case "/":
+		return &object.Decimal{Value: left / right}
+	case "%":
+		return &object.Decimal{Value: math.Mod(left, right)}
+	case "<":
+		return convertBoolean(left < right)
+	case ">":
+		return convertBoolean(left > right)
+	case "==":
+		return convertBoolean(left == right)
+	case "!=":
+		return convertBoolean(left != right)
+	case ">=":
+		return convertBoolean(left >= right)
+	case "<=":
+		return convertBoolean(left <= right)
+	default:
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s", leftObj.Type(), op, rightObj.Type())
+	}
+}
@@ -1,27 +1,76 @@
 package monkey_lexer
 
-import token "myMonkey/monkey_token"
+import (
+	"fmt"
+	token "myMonkey/monkey_token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	src          string
+	file         string
 	pos, readPos int
-	ch           byte
+	line, col    int
+	ch           rune
+	width        int
+	emitComments bool
+	errors       []Error
 }
 
+// Error explains why the lexer produced an ILLEGAL token at Pos.
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) Error() string { return e.Pos.String() + ": " + e.Message }
+
 func NewLexer(src string) *Lexer {
-	l := &Lexer{src: src}
+	return NewFileLexer("", src)
+}
+
+// NewFileLexer creates a lexer whose token positions carry the given file name.
+func NewFileLexer(file, src string) *Lexer {
+	l := &Lexer{src: src, file: file, line: 1}
 	l.readCh()
 	return l
 }
 
 func (l *Lexer) readCh() {
-	if l.readPos >= len(l.src) {
-		l.ch = 0
+	if l.ch == '\n' {
+		l.line++
+		l.col = 1
 	} else {
-		l.ch = l.src[l.readPos]
+		l.col++
 	}
 	l.pos = l.readPos
-	l.readPos++
+	if l.readPos >= len(l.src) {
+		l.ch, l.width = 0, 0
+	} else {
+		l.ch, l.width = utf8.DecodeRuneInString(l.src[l.readPos:])
+	}
+	l.readPos += l.width
+}
+
+// EmitComments makes NextToken return COMMENT tokens instead of skipping them.
+func (l *Lexer) EmitComments(emit bool) {
+	l.emitComments = emit
+}
+
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
+func (l *Lexer) illegal(pos token.Position, literal, format string, a ...interface{}) token.Token {
+	l.errors = append(l.errors, Error{Pos: pos, Message: fmt.Sprintf(format, a...)})
+	return token.Token{Type: token.ILLEGAL, Literal: literal, Pos: pos}
+}
+
+func (l *Lexer) position() token.Position {
+	return token.Position{File: l.file, Line: l.line, Column: l.col}
 }
 
 func (l *Lexer) readTwoCh() string {
@@ -30,41 +79,71 @@ func (l *Lexer) readTwoCh() string {
 	return string(ch) + string(l.ch)
 }
 
-func (l *Lexer) peekCh() byte {
+func (l *Lexer) peekCh() rune {
 	if l.readPos >= len(l.src) {
 		return 0
 	} else {
-		return l.src[l.readPos]
+		ch, _ := utf8.DecodeRuneInString(l.src[l.readPos:])
+		return ch
 	}
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
-	var True = true
 	l.skipEmpty()
+	pos := l.position()
 	switch l.ch {
 	case '=':
 		if l.peekCh() == '=' {
 			tok = token.Token{Type: token.EQ, Literal: l.readTwoCh()}
+		} else if l.peekCh() == '>' {
+			tok = token.Token{Type: token.ARROW, Literal: l.readTwoCh()}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
 		if l.peekCh() == '+' {
 			tok = token.Token{Type: token.BUMPPLUS, Literal: l.readTwoCh()}
+		} else if l.peekCh() == '=' {
+			tok = token.Token{Type: token.PLUSASSIGN, Literal: l.readTwoCh()}
 		} else {
 			tok = newToken(token.PLUS, l.ch)
 		}
 	case '-':
 		if l.peekCh() == '-' {
 			tok = token.Token{Type: token.BUMPMINUS, Literal: l.readTwoCh()}
+		} else if l.peekCh() == '=' {
+			tok = token.Token{Type: token.MINUSASSIGN, Literal: l.readTwoCh()}
 		} else {
 			tok = newToken(token.MINUS, l.ch)
 		}
 	case '*':
-		tok = newToken(token.MULTIPLY, l.ch)
+		if l.peekCh() == '*' {
+			tok = token.Token{Type: token.POWER, Literal: l.readTwoCh()}
+		} else if l.peekCh() == '=' {
+			tok = token.Token{Type: token.MULTIPLYASSIGN, Literal: l.readTwoCh()}
+		} else {
+			tok = newToken(token.MULTIPLY, l.ch)
+		}
 	case '/':
-		tok = newToken(token.DIVIDE, l.ch)
+		if l.peekCh() == '/' || l.peekCh() == '*' {
+			tok = l.readComment(pos)
+			if tok.Type == token.COMMENT && !l.emitComments {
+				return l.NextToken()
+			}
+			return tok
+		}
+		if l.peekCh() == '=' {
+			tok = token.Token{Type: token.DIVIDEASSIGN, Literal: l.readTwoCh()}
+		} else {
+			tok = newToken(token.DIVIDE, l.ch)
+		}
+	case '%':
+		if l.peekCh() == '=' {
+			tok = token.Token{Type: token.MODULOASSIGN, Literal: l.readTwoCh()}
+		} else {
+			tok = newToken(token.MODULO, l.ch)
+		}
 	case '!':
 		if l.peekCh() == '=' {
 			tok = token.Token{Type: token.NEQ, Literal: l.readTwoCh()}
@@ -76,6 +155,10 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.Token{Type: token.LE, Literal: l.readTwoCh()}
 		} else if l.peekCh() == '<' {
 			tok = token.Token{Type: token.LSHIFT, Literal: l.readTwoCh()}
+			if l.peekCh() == '=' {
+				l.readCh()
+				tok = token.Token{Type: token.LSHIFTASSIGN, Literal: "<<="}
+			}
 		} else {
 			tok = newToken(token.LT, l.ch)
 		}
@@ -84,6 +167,10 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.Token{Type: token.GE, Literal: l.readTwoCh()}
 		} else if l.peekCh() == '>' {
 			tok = token.Token{Type: token.RSHIFT, Literal: l.readTwoCh()}
+			if l.peekCh() == '=' {
+				l.readCh()
+				tok = token.Token{Type: token.RSHIFTASSIGN, Literal: ">>="}
+			}
 		} else {
 			tok = newToken(token.GT, l.ch)
 		}
@@ -106,27 +193,63 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '|':
-		tok = newToken(token.VERTICAL, l.ch)
+		if l.peekCh() == '|' {
+			tok = token.Token{Type: token.OR, Literal: l.readTwoCh()}
+		} else if l.peekCh() == '>' {
+			tok = token.Token{Type: token.PIPE, Literal: l.readTwoCh()}
+		} else {
+			tok = newToken(token.VERTICAL, l.ch)
+		}
+	case '&':
+		if l.peekCh() == '&' {
+			tok = token.Token{Type: token.AND, Literal: l.readTwoCh()}
+		} else {
+			tok = newToken(token.BITAND, l.ch)
+		}
+	case '?':
+		if l.peekCh() == '?' {
+			tok = token.Token{Type: token.COALESCE, Literal: l.readTwoCh()}
+		} else if strings.HasPrefix(l.src[l.pos:], "?.[") {
+			l.readCh()
+			l.readCh()
+			tok = token.Token{Type: token.SAFEINDEX, Literal: "?.["}
+		} else {
+			tok = newToken(token.QUESTION, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BITXOR, l.ch)
+	case '~':
+		if l.peekCh() == '/' {
+			tok = token.Token{Type: token.INTDIVIDE, Literal: l.readTwoCh()}
+		} else {
+			tok = newToken(token.BITNOT, l.ch)
+		}
 	case 0:
 		tok = token.Token{Type: token.EOF, Literal: ""}
 	case '"':
-		tok = token.Token{Type: token.STRING, Literal: l.readStr()}
+		return l.readStr(pos)
 	default:
 		if isLetter(l.ch) {
 			ident := l.readIdent()
-			tok = token.Token{Type: token.LookupKeyword(ident), Literal: ident}
-			return tok
-		} else if isNumber(l.ch, &True) {
-			return token.Token{Type: token.NUMBER, Literal: l.readNum()}
+			return token.Token{Type: token.LookupKeyword(ident), Literal: ident, Pos: pos}
+		} else if isDigit(l.ch) || l.ch == '.' && isDigit(l.peekCh()) {
+			return l.readNum(pos)
+		} else if strings.HasPrefix(l.src[l.pos:], "...") {
+			l.readCh()
+			l.readCh()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.ch == utf8.RuneError && l.width == 1 {
+			tok = l.illegal(pos, l.src[l.pos:l.readPos], "invalid UTF-8 encoding")
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
+	tok.Pos = pos
 	l.readCh()
 	return tok
 }
 
-func newToken(tType token.TokenType, ch byte) token.Token {
+func newToken(tType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tType, Literal: string(ch)}
 }
 
@@ -138,34 +261,225 @@ func (l *Lexer) readIdent() string {
 	return l.src[pos:l.pos]
 }
 
-func (l *Lexer) readNum() string {
-	pos := l.pos
-	l.readCh()
-	for hasFloatingPoint := false; isNumber(l.ch, &hasFloatingPoint); l.readCh() {
+// readNum reads everything that could belong to a numeric literal and then
+// validates it, so that `1.2.3` or `0b102` become a single ILLEGAL token with
+// a precise message instead of being split into several numbers.
+func (l *Lexer) readNum(pos token.Position) token.Token {
+	start := l.pos
+	prefixed := l.ch == '0' && strings.ContainsRune("xXoObB", l.peekCh())
+	for {
+		prev := l.ch
+		l.readCh()
+		if isDigit(l.ch) || isLetter(l.ch) || l.ch == '.' {
+			continue
+		}
+		if !prefixed && (l.ch == '+' || l.ch == '-') && (prev == 'e' || prev == 'E') {
+			continue
+		}
+		break
+	}
+	literal := l.src[start:l.pos]
+	if msg := checkNumber(literal); msg != "" {
+		return l.illegal(pos, literal, "malformed number %s: %s", literal, msg)
+	}
+	return token.Token{Type: token.NUMBER, Literal: literal, Pos: pos}
+}
+
+// checkNumber validates a numeric literal and describes the first problem.
+func checkNumber(literal string) string {
+	if len(literal) > 1 && literal[0] == '0' {
+		base := map[byte]string{'x': "hexadecimal", 'X': "hexadecimal", 'o': "octal", 'O': "octal", 'b': "binary", 'B': "binary"}
+		if name, ok := base[literal[1]]; ok {
+			digits := literal[2:]
+			if digits == "" {
+				return name + " literal has no digits"
+			}
+			for _, ch := range digits {
+				if ch != '_' && !isDigitIn(ch, name) {
+					return fmt.Sprintf("invalid digit %q in %s literal", ch, name)
+				}
+			}
+			return checkSeparators(digits)
+		}
+	}
+	mantissa, exponent := literal, ""
+	if i := strings.IndexAny(literal, "eE"); i >= 0 {
+		mantissa, exponent = literal[:i], literal[i+1:]
+		if exponent == "" || exponent == "+" || exponent == "-" {
+			return "exponent has no digits"
+		}
+		if exponent[0] == '+' || exponent[0] == '-' {
+			exponent = exponent[1:]
+		}
+	}
+	if strings.Count(mantissa, ".") > 1 {
+		return "multiple decimal points"
+	}
+	for i, ch := range mantissa + exponent {
+		if ch != '_' && !isDigit(ch) && (ch != '.' || i >= len(mantissa)) {
+			return fmt.Sprintf("invalid character %q", ch)
+		}
+	}
+	integer, fraction, hasPoint := strings.Cut(mantissa, ".")
+	if hasPoint && fraction == "" {
+		return "decimal point must be followed by digits"
+	}
+	for _, part := range []string{integer, fraction, exponent} {
+		if msg := checkSeparators(part); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// checkSeparators reports `_` that does not sit between two digits.
+func checkSeparators(digits string) string {
+	if strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+		return "'_' must separate successive digits"
+	}
+	return ""
+}
+
+func isDigitIn(ch rune, base string) bool {
+	switch base {
+	case "hexadecimal":
+		return isHexDigit(ch)
+	case "octal":
+		return '0' <= ch && ch <= '7'
+	default:
+		return ch == '0' || ch == '1'
 	}
-	return l.src[pos:l.pos]
 }
 
-func (l *Lexer) readStr() string {
-	pos := l.pos + 1
+// readStr reads a string literal and decodes its escape sequences. A bad
+// escape makes the whole literal ILLEGAL, positioned at the offending escape.
+func (l *Lexer) readStr(pos token.Position) token.Token {
+	start := l.pos
+	var out strings.Builder
+	var bad *Error
 	for {
 		l.readCh()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		if l.pos >= len(l.src) {
+			return l.illegal(pos, l.src[start:l.pos], "unterminated string literal")
+		}
+		switch l.ch {
+		case '"':
+			literal := l.src[start : l.pos+1]
+			l.readCh()
+			if bad != nil {
+				return l.illegal(bad.Pos, literal, "%s", bad.Message)
+			}
+			return token.Token{Type: token.STRING, Literal: out.String(), Pos: pos}
+		case '\\':
+			escPos := l.position()
+			if msg := l.readEscape(&out); msg != "" && bad == nil {
+				bad = &Error{Pos: escPos, Message: msg}
+			}
+		default:
+			out.WriteString(l.src[l.pos:l.readPos])
 		}
 	}
-	return l.src[pos:l.pos]
 }
 
-func isLetter(ch byte) bool {
-	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == '$'
+// readEscape decodes the escape sequence starting at the backslash under the
+// lexer into out, leaving the lexer on its last character. It returns a
+// description of the problem if the escape is malformed.
+func (l *Lexer) readEscape(out *strings.Builder) string {
+	switch l.peekCh() {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\':
+		out.WriteByte('\\')
+	case '"':
+		out.WriteByte('"')
+	case 'x':
+		l.readCh()
+		hex := l.readHexDigits(2)
+		if len(hex) != 2 {
+			return "invalid escape sequence: \\x must be followed by two hex digits"
+		}
+		value, _ := strconv.ParseUint(hex, 16, 8)
+		out.WriteByte(byte(value))
+		return ""
+	case 'u':
+		l.readCh()
+		if l.peekCh() != '{' {
+			return "invalid escape sequence: \\u must be followed by {"
+		}
+		l.readCh()
+		hex := l.readHexDigits(6)
+		if l.peekCh() != '}' || len(hex) == 0 {
+			return "invalid escape sequence: \\u{...} must contain 1 to 6 hex digits"
+		}
+		l.readCh()
+		value, _ := strconv.ParseUint(hex, 16, 32)
+		if value > unicode.MaxRune || 0xD800 <= value && value <= 0xDFFF {
+			return fmt.Sprintf("invalid escape sequence: \\u{%s} is not a valid code point", hex)
+		}
+		out.WriteRune(rune(value))
+		return ""
+	case 0:
+		return "invalid escape sequence at end of input"
+	default:
+		return fmt.Sprintf("invalid escape sequence: \\%c", l.peekCh())
+	}
+	l.readCh()
+	return ""
+}
+
+// readHexDigits consumes up to max hex digits following the current character.
+func (l *Lexer) readHexDigits(max int) string {
+	start := l.readPos
+	for i := 0; i < max && isHexDigit(l.peekCh()); i++ {
+		l.readCh()
+	}
+	return l.src[start:l.readPos]
+}
+
+func isHexDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
 }
 
-func isNumber(ch byte, hasFloatingPoint *bool) bool {
-	if ch == '.' && !*hasFloatingPoint {
-		*hasFloatingPoint = true
-		return true
+// readComment reads a `//` line comment or a possibly nested `/* */` block
+// comment, leaving the lexer on the first character after it.
+func (l *Lexer) readComment(pos token.Position) token.Token {
+	start := l.pos
+	if l.peekCh() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readCh()
+		}
+		return token.Token{Type: token.COMMENT, Literal: l.src[start:l.pos], Pos: pos}
+	}
+	l.readCh()
+	l.readCh()
+	for depth := 1; depth > 0; {
+		switch {
+		case l.ch == 0:
+			return l.illegal(pos, l.src[start:l.pos], "unterminated block comment")
+		case l.ch == '*' && l.peekCh() == '/':
+			depth--
+			l.readCh()
+			l.readCh()
+		case l.ch == '/' && l.peekCh() == '*':
+			depth++
+			l.readCh()
+			l.readCh()
+		default:
+			l.readCh()
+		}
 	}
+	return token.Token{Type: token.COMMENT, Literal: l.src[start:l.pos], Pos: pos}
+}
+
+func isLetter(ch rune) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == '$' || ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
@@ -16,7 +16,7 @@ func TestLexer(t *testing.T) {
 		def ten = 10;
 		def add = func(x, y) {ret x + y;};
 		def result = add(five, ten);
-		!-/*5;
+		!-/ *5;
 		5 < 10 > 5;
 		5 <= 10 >= 5;
 		5 << 10 >> 5;
@@ -148,7 +148,7 @@ func TestLexer(t *testing.T) {
 		{token.LBRACE, "{"},
 		{token.RBRACE, "}"},
 		{token.STRING, "foobar"},
-		{token.STRING, `foo\t\r\n bar`},
+		{token.STRING, "foo\t\r\n bar"},
 		{token.LBRACE, "{"},
 		{token.STRING, "Name"},
 		{token.COLON, ":"},
@@ -159,18 +159,389 @@ func TestLexer(t *testing.T) {
 	dealTesting(t, input, tests)
 }
 
+func TestLexerLogicalOperators(t *testing.T) {
+	input := "a && b || c | d & e |> f"
+	tests := []aTest{
+		{token.IDENTIFIER, "a"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "b"},
+		{token.OR, "||"},
+		{token.IDENTIFIER, "c"},
+		{token.VERTICAL, "|"},
+		{token.IDENTIFIER, "d"},
+		{token.BITAND, "&"},
+		{token.IDENTIFIER, "e"},
+		{token.PIPE, "|>"},
+		{token.IDENTIFIER, "f"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
+func TestLexerArithmeticOperators(t *testing.T) {
+	input := "a ** b ~/ c % d ^ ~e * f"
+	tests := []aTest{
+		{token.IDENTIFIER, "a"},
+		{token.POWER, "**"},
+		{token.IDENTIFIER, "b"},
+		{token.INTDIVIDE, "~/"},
+		{token.IDENTIFIER, "c"},
+		{token.MODULO, "%"},
+		{token.IDENTIFIER, "d"},
+		{token.BITXOR, "^"},
+		{token.BITNOT, "~"},
+		{token.IDENTIFIER, "e"},
+		{token.MULTIPLY, "*"},
+		{token.IDENTIFIER, "f"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
+func TestLexerAssignOperators(t *testing.T) {
+	input := "a += b -= c *= d /= e %= f <<= g >>= h++--"
+	tests := []aTest{
+		{token.IDENTIFIER, "a"},
+		{token.PLUSASSIGN, "+="},
+		{token.IDENTIFIER, "b"},
+		{token.MINUSASSIGN, "-="},
+		{token.IDENTIFIER, "c"},
+		{token.MULTIPLYASSIGN, "*="},
+		{token.IDENTIFIER, "d"},
+		{token.DIVIDEASSIGN, "/="},
+		{token.IDENTIFIER, "e"},
+		{token.MODULOASSIGN, "%="},
+		{token.IDENTIFIER, "f"},
+		{token.LSHIFTASSIGN, "<<="},
+		{token.IDENTIFIER, "g"},
+		{token.RSHIFTASSIGN, ">>="},
+		{token.IDENTIFIER, "h"},
+		{token.BUMPPLUS, "++"},
+		{token.BUMPMINUS, "--"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
+func TestLexerMatch(t *testing.T) {
+	input := "match (x) { _ => 1 }"
+	tests := []aTest{
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENTIFIER, "_"},
+		{token.ARROW, "=>"},
+		{token.NUMBER, "1"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
+func TestLexerTry(t *testing.T) {
+	input := "try {} catch (e) {} finally {}"
+	tests := []aTest{
+		{token.TRY, "try"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.CATCH, "catch"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "e"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.FINALLY, "finally"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
+func TestLexerQuestionOperators(t *testing.T) {
+	input := "a ? b : c ?? h?.[k]"
+	tests := []aTest{
+		{token.IDENTIFIER, "a"},
+		{token.QUESTION, "?"},
+		{token.IDENTIFIER, "b"},
+		{token.COLON, ":"},
+		{token.IDENTIFIER, "c"},
+		{token.COALESCE, "??"},
+		{token.IDENTIFIER, "h"},
+		{token.SAFEINDEX, "?.["},
+		{token.IDENTIFIER, "k"},
+		{token.RBRACKET, "]"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
+func TestLexerArrowFunction(t *testing.T) {
+	input := "(a, ...xs) => .5"
+	tests := []aTest{
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENTIFIER, "xs"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "=>"},
+		{token.NUMBER, ".5"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
 func TestLexerParsingFloating(t *testing.T) {
 	input := "-127.1.1.1;"
 	tests := []aTest{
 		{token.MINUS, "-"},
-		{token.NUMBER, "127.1"},
-		{token.ILLEGAL, "."},
-		{token.NUMBER, "1.1"},
+		{token.ILLEGAL, "127.1.1.1"},
+		{token.SEMICOLON, ";"},
+	}
+	l := dealTesting(t, input, tests)
+	if len(l.Errors()) != 1 || l.Errors()[0].Error() != "1:2: malformed number 127.1.1.1: multiple decimal points" {
+		t.Fatalf("wrong errors. got=%v", l.Errors())
+	}
+}
+
+func TestLexerNumbers(t *testing.T) {
+	input := ".5 0xFF 0Xdead_BEEF 0o17 0b1010_0101 1e-9 2.5E+3 1_000_000 3.141_592 0x1e-9"
+	tests := []aTest{
+		{token.NUMBER, ".5"},
+		{token.NUMBER, "0xFF"},
+		{token.NUMBER, "0Xdead_BEEF"},
+		{token.NUMBER, "0o17"},
+		{token.NUMBER, "0b1010_0101"},
+		{token.NUMBER, "1e-9"},
+		{token.NUMBER, "2.5E+3"},
+		{token.NUMBER, "1_000_000"},
+		{token.NUMBER, "3.141_592"},
+		{token.NUMBER, "0x1e"},
+		{token.MINUS, "-"},
+		{token.NUMBER, "9"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
+func TestLexerMalformedNumbers(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"0x", "hexadecimal literal has no digits"},
+		{"0b102", "invalid digit '2' in binary literal"},
+		{"0o78", "invalid digit '8' in octal literal"},
+		{"0xFG", "invalid digit 'G' in hexadecimal literal"},
+		{"1e", "exponent has no digits"},
+		{"1e+", "exponent has no digits"},
+		{"1.", "decimal point must be followed by digits"},
+		{"12abc", "invalid character 'a'"},
+		{"1__0", "'_' must separate successive digits"},
+		{"1_", "'_' must separate successive digits"},
+		{"0x_1", "'_' must separate successive digits"},
+		{"1.5e3.2", "invalid character '.'"},
+	}
+	for _, test := range tests {
+		l := NewLexer(test.input + ";")
+		tok := l.NextToken()
+		if tok.Type != token.ILLEGAL || tok.Literal != test.input {
+			t.Errorf("%s: expected ILLEGAL token, got %s %q", test.input, tok.Type, tok.Literal)
+			continue
+		}
+		want := "1:1: malformed number " + test.input + ": " + test.err
+		if len(l.Errors()) != 1 || l.Errors()[0].Error() != want {
+			t.Errorf("%s: wrong errors. got=%v, want=%q", test.input, l.Errors(), want)
+		}
+		if next := l.NextToken(); next.Type != token.SEMICOLON {
+			t.Errorf("%s: lexer did not resume after the number. got=%s", test.input, next.Type)
+		}
+	}
+}
+
+func TestLexerComments(t *testing.T) {
+	input := `// leading comment
+def x = 5; // trailing
+def y = x/* inline */+/**/2;
+def z = /* outer /* nested */ still comment */ x//adjacent
+/ 2;
+x // comment at EOF`
+	tests := []aTest{
+		{token.DEFINE, "def"},
+		{token.IDENTIFIER, "x"},
+		{token.ASSIGN, "="},
+		{token.NUMBER, "5"},
+		{token.SEMICOLON, ";"},
+		{token.DEFINE, "def"},
+		{token.IDENTIFIER, "y"},
+		{token.ASSIGN, "="},
+		{token.IDENTIFIER, "x"},
+		{token.PLUS, "+"},
+		{token.NUMBER, "2"},
+		{token.SEMICOLON, ";"},
+		{token.DEFINE, "def"},
+		{token.IDENTIFIER, "z"},
+		{token.ASSIGN, "="},
+		{token.IDENTIFIER, "x"},
+		{token.DIVIDE, "/"},
+		{token.NUMBER, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.EOF, ""},
 	}
 	dealTesting(t, input, tests)
 }
 
-func dealTesting(t *testing.T, input string, tests []aTest) {
+func TestLexerEmitComments(t *testing.T) {
+	input := "a /* b /* c */ */ // d\n/ e //"
+	tests := []aTest{
+		{token.IDENTIFIER, "a"},
+		{token.COMMENT, "/* b /* c */ */"},
+		{token.COMMENT, "// d"},
+		{token.DIVIDE, "/"},
+		{token.IDENTIFIER, "e"},
+		{token.COMMENT, "//"},
+		{token.EOF, ""},
+	}
+	l := NewLexer(input)
+	l.EmitComments(true)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestLexerUnterminatedComment(t *testing.T) {
+	input := "x + /* one /* two */"
+	tests := []aTest{
+		{token.IDENTIFIER, "x"},
+		{token.PLUS, "+"},
+		{token.ILLEGAL, "/* one /* two */"},
+		{token.EOF, ""},
+	}
+	l := dealTesting(t, input, tests)
+	if len(l.Errors()) != 1 {
+		t.Fatalf("wrong number of errors. got=%d", len(l.Errors()))
+	}
+	if l.Errors()[0].Error() != "1:5: unterminated block comment" {
+		t.Fatalf("wrong error. got=%q", l.Errors()[0].Error())
+	}
+}
+
+func TestLexerStringEscapes(t *testing.T) {
+	input := `"a\nb" "tab\there" "q\"uote" "back\\slash" "\x41\x7a" "\u{48}\u{e9}\u{1F600}" "multi
+line"`
+	tests := []aTest{
+		{token.STRING, "a\nb"},
+		{token.STRING, "tab\there"},
+		{token.STRING, "q\"uote"},
+		{token.STRING, "back\\slash"},
+		{token.STRING, "Az"},
+		{token.STRING, "H\u00e9\U0001F600"},
+		{token.STRING, "multi\nline"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+}
+
+func TestLexerStringErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		literal string
+		err     string
+	}{
+		{`"abc`, `"abc`, "1:1: unterminated string literal"},
+		{`x = "a\qb";`, `"a\qb"`, "1:7: invalid escape sequence: \\q"},
+		{`"\xZZ"`, `"\xZZ"`, "1:2: invalid escape sequence: \\x must be followed by two hex digits"},
+		{`"\u41"`, `"\u41"`, "1:2: invalid escape sequence: \\u must be followed by {"},
+		{`"\u{}"`, `"\u{}"`, "1:2: invalid escape sequence: \\u{...} must contain 1 to 6 hex digits"},
+		{`"ok\u{D800}"`, `"ok\u{D800}"`, "1:4: invalid escape sequence: \\u{D800} is not a valid code point"},
+	}
+	for _, test := range tests {
+		l := NewLexer(test.input)
+		tok := l.NextToken()
+		for tok.Type != token.ILLEGAL && tok.Type != token.EOF {
+			tok = l.NextToken()
+		}
+		if tok.Type != token.ILLEGAL || tok.Literal != test.literal {
+			t.Errorf("%s: expected ILLEGAL %q, got %s %q", test.input, test.literal, tok.Type, tok.Literal)
+			continue
+		}
+		if len(l.Errors()) != 1 || l.Errors()[0].Error() != test.err {
+			t.Errorf("%s: wrong errors. got=%v, want=%q", test.input, l.Errors(), test.err)
+		}
+		if next := l.NextToken(); test.input[len(test.input)-1] == ';' && next.Type != token.SEMICOLON {
+			t.Errorf("%s: lexer did not resume after the string. got=%s", test.input, next.Type)
+		}
+	}
+}
+
+func TestLexerUnicode(t *testing.T) {
+	input := `def 名字 = "世界"; café + ñ; "\u{4e16}界" ★`
+	tests := []aTest{
+		{token.DEFINE, "def"},
+		{token.IDENTIFIER, "名字"},
+		{token.ASSIGN, "="},
+		{token.STRING, "世界"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "café"},
+		{token.PLUS, "+"},
+		{token.IDENTIFIER, "ñ"},
+		{token.SEMICOLON, ";"},
+		{token.STRING, "世界"},
+		{token.ILLEGAL, "★"},
+		{token.EOF, ""},
+	}
+	dealTesting(t, input, tests)
+
+	l := NewLexer("名字 = 1;")
+	l.NextToken()
+	if tok := l.NextToken(); tok.Pos.Column != 4 {
+		t.Fatalf("column should count runes. got=%d, want=4", tok.Pos.Column)
+	}
+	l = NewLexer("a\xff")
+	l.NextToken()
+	if tok := l.NextToken(); tok.Type != token.ILLEGAL || len(l.Errors()) != 1 {
+		t.Fatalf("invalid UTF-8 should be ILLEGAL. got=%s %q", tok.Type, tok.Literal)
+	}
+}
+
+func TestLexerPositions(t *testing.T) {
+	input := "def x = 5;\n  x <= 10;\n\"ab\""
+	tests := []struct {
+		expectedType token.TokenType
+		line, column int
+	}{
+		{token.DEFINE, 1, 1},
+		{token.IDENTIFIER, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.NUMBER, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENTIFIER, 2, 3},
+		{token.LE, 2, 5},
+		{token.NUMBER, 2, 8},
+		{token.SEMICOLON, 2, 10},
+		{token.STRING, 3, 1},
+		{token.EOF, 3, 5},
+	}
+	l := NewFileLexer("test.mk", input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.File != "test.mk" || tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Fatalf("tests[%d] - position wrong. expected=test.mk:%d:%d, got=%s", i, tt.line, tt.column, tok.Pos)
+		}
+	}
+}
+
+func dealTesting(t *testing.T, input string, tests []aTest) *Lexer {
 	l := NewLexer(input)
 
 	for i, tt := range tests {
@@ -182,4 +553,5 @@ func dealTesting(t *testing.T, input string, tests []aTest) {
 			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
 		}
 	}
+	return l
 }
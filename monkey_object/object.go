@@ -2,10 +2,13 @@ package monkey_object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"hash/fnv"
 	"math"
+	"math/big"
 	ast "myMonkey/monkey_ast"
+	token "myMonkey/monkey_token"
 	"strconv"
 	"strings"
 )
@@ -15,15 +18,37 @@ type BuiltinFn func(args ...Object) Object
 
 const (
 	DECIMAL_OBJ      ObjectType = "DECIMAL"
+	INTEGER_OBJ                 = "INTEGER"
+	BIGINT_OBJ                  = "BIGINT"
+	RATIONAL_OBJ                = "RATIONAL"
 	BOOLEAN_OBJ                 = "BOOLEAN"
 	NULL_OBJ                    = "NULL"
 	RETURN_VALUE_OBJ            = "RETURN_VALUE"
+	TAIL_CALL_OBJ               = "TAIL_CALL"
 	ERROR_OBJ                   = "ERROR"
 	FUNCTION_OBJ                = "FUNCTION"
 	STRING_OBJ                  = "STRING"
 	BUILTIN_OBJ                 = "BUILTIN"
 	ARRAY_OBJ                   = "ARRAY"
 	HASH_OBJ                    = "HASH"
+	BREAK_OBJ                   = "BREAK"
+	CONTINUE_OBJ                = "CONTINUE"
+	EXCEPTION_OBJ               = "EXCEPTION"
+)
+
+// Error kinds, reported in tracebacks and by the "kind" field of a caught
+// exception.
+const (
+	ERROR            = "Error"
+	TYPE_ERROR       = "TypeError"
+	NAME_ERROR       = "NameError"
+	ARGUMENT_ERROR   = "ArgumentError"
+	ARITHMETIC_ERROR = "ArithmeticError"
+	INDEX_ERROR      = "IndexError"
+	KEY_ERROR        = "KeyError"
+	VALUE_ERROR      = "ValueError"
+	// LIMIT_ERROR stops an evaluation that ran out of budget; try cannot catch it.
+	LIMIT_ERROR = "LimitError"
 )
 
 type Object interface {
@@ -51,31 +76,98 @@ func boolToInt(b bool) uint64 {
 	return 0
 }
 
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Inspect() string  { return strconv.FormatInt(i.Value, 10) }
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) HashKey() HashKey { return HashKey{Type: i.Type(), Value: uint64(i.Value)} }
+
+// BigInt is an arbitrary-precision integer. Values that fit into an int64
+// hash like the equal Integer so both can be used for the same hash key.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) HashKey() HashKey {
+	if b.Value.IsInt64() {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(b.Value.Int64())}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(b.Value.String()))
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// Rational is an exact fraction. It is printed as a decimal when its
+// expansion terminates and as num/den otherwise.
+type Rational struct {
+	Value *big.Rat
+}
+
+func (r *Rational) Inspect() string {
+	if r.Value.IsInt() {
+		return r.Value.Num().String()
+	}
+	if places, ok := terminatingPlaces(r.Value.Denom()); ok {
+		return r.Value.FloatString(places)
+	}
+	return r.Value.RatString()
+}
+func (r *Rational) Type() ObjectType { return RATIONAL_OBJ }
+func (r *Rational) HashKey() HashKey {
+	if r.Value.IsInt() && r.Value.Num().IsInt64() {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(r.Value.Num().Int64())}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(r.Value.RatString()))
+	return HashKey{Type: r.Type(), Value: h.Sum64()}
+}
+
+// terminatingPlaces reports how many decimal places a fraction with the
+// given reduced denominator needs, if its decimal expansion terminates.
+func terminatingPlaces(denom *big.Int) (int, bool) {
+	d := new(big.Int).Set(denom)
+	twos, fives := 0, 0
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	for mod.Mod(d, two).Sign() == 0 {
+		d.Quo(d, two)
+		twos++
+	}
+	for mod.Mod(d, five).Sign() == 0 {
+		d.Quo(d, five)
+		fives++
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	return max(twos, fives), true
+}
+
 type Decimal struct {
 	Value float64
 }
 
 func (d *Decimal) Inspect() string  { return fmt.Sprintf("%f", d.Value) }
 func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+
+// HashKey of a Decimal is that of the equal Integer, BigInt or Rational, since
+// 7 == 7.0 and rational(1, 2) == 0.5 must find the same hash entry.
 func (d *Decimal) HashKey() HashKey {
-	var out bytes.Buffer
-	iNT, frac := math.Modf(d.Value)
-	fmt.Fprintf(&out, "%d%d%d%d", int(iNT), int(frac), countDecimalPlaces(d.Value), boolToInt(d.Value < 0))
-	val, err := strconv.Atoi(out.String())
-	if err != nil {
-		panic(err)
+	if d.Value == math.Trunc(d.Value) && !math.IsInf(d.Value, 0) {
+		if d.Value >= math.MinInt64 && d.Value < math.MaxInt64 {
+			return HashKey{Type: INTEGER_OBJ, Value: uint64(int64(d.Value))}
+		}
+		i, _ := big.NewFloat(d.Value).Int(nil)
+		return (&BigInt{Value: i}).HashKey()
 	}
-	return HashKey{Type: d.Type(), Value: uint64(val)}
-}
-
-func countDecimalPlaces(f float64) int {
-	_, frac := math.Modf(f)
-	fracStr := fmt.Sprintf("%g", frac)
-	dotIndex := strings.IndexByte(fracStr, '.')
-	if dotIndex == -1 {
-		return 0
+	if r := new(big.Rat).SetFloat64(d.Value); r != nil {
+		return (&Rational{Value: r}).HashKey()
 	}
-	return len(fracStr) - dotIndex - 1
+	return HashKey{Type: d.Type(), Value: math.Float64bits(d.Value)}
 }
 
 type Boolean struct {
@@ -98,26 +190,187 @@ type ReturnValue struct {
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 
+// TailCall is a call in `ret f(...)` that has not been made yet. It is
+// returned to the function application that is running, which makes the call
+// in its place instead of growing the stack.
+type TailCall struct {
+	Function *Function
+	Args     []Object
+	Pos      token.Position
+}
+
+func (tc *TailCall) Inspect() string  { return "tail call" }
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+
+type Break struct{}
+
+func (b *Break) Inspect() string  { return "break" }
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+
+type Continue struct{}
+
+func (c *Continue) Inspect() string  { return "continue" }
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+
 type Error struct {
 	Message string
+	Kind    string // one of the error kinds above, ERROR if empty
+	Pos     token.Position
+	// Trace lists the calls the error unwound through, innermost first.
+	Trace []Frame
+	// Value is the value passed to throw, nil for errors raised by the
+	// interpreter.
+	Value Object
+	// Rethrown is set on the copy throw(e) makes of a caught error, so that
+	// the call to throw is not traced as if it had raised the error.
+	Rethrown bool
+}
+
+func (e *Error) KindName() string {
+	if e.Kind == "" {
+		return ERROR
+	}
+	return e.Kind
+}
+
+// Frame is one call in a stack trace: the function that was called and the
+// position of the call.
+type Frame struct {
+	Function string
+	Pos      token.Position
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// Traceback formats the error like a Python traceback, outermost call first.
+// Each line shows where execution was in a function: the call to the next
+// function, or for the last line the place the error was raised.
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+	out.WriteString("Traceback (most recent call last):\n")
+	caller := "<main>"
+	var last string
+	repeated := 0
+	line := func(pos token.Position, function string) {
+		var l string
+		if pos.IsValid() {
+			file := pos.File
+			if file == "" {
+				file = "<stdin>"
+			}
+			l = fmt.Sprintf("  File %q, line %d, column %d, in %s\n", file, pos.Line, pos.Column, function)
+		} else {
+			l = fmt.Sprintf("  in %s\n", function)
+		}
+		// Deep recursion would print the same line thousands of times.
+		if l == last {
+			repeated++
+			if repeated > 2 {
+				return
+			}
+		} else {
+			flushRepeats(&out, repeated)
+			repeated = 0
+		}
+		last = l
+		out.WriteString(l)
+	}
+	for i := len(e.Trace) - 1; i >= 0; i-- {
+		line(e.Trace[i].Pos, caller)
+		caller = e.Trace[i].Function
+	}
+	line(e.Pos, caller)
+	flushRepeats(&out, repeated)
+	out.WriteString(e.KindName() + ": " + e.Message + "\n")
+	return out.String()
+}
+
+// Exception is an error caught by try/catch. Unlike an Error it is an
+// ordinary value; its fields are read by indexing it with "message", "kind",
+// "position", "trace" or "value".
+type Exception struct {
+	Err *Error
+}
+
+func (e *Exception) Type() ObjectType { return EXCEPTION_OBJ }
+func (e *Exception) Inspect() string {
+	return e.Err.KindName() + ": " + e.Err.Message
+}
+
+// Field returns the named field of the exception, or nil if there is none.
+// The trace is an array of hashes with "function" and "position" keys,
+// outermost call first.
+func (e *Exception) Field(name string) Object {
+	switch name {
+	case "message":
+		return &String{Value: e.Err.Message}
+	case "kind":
+		return &String{Value: e.Err.KindName()}
+	case "position":
+		return &String{Value: e.Err.Pos.String()}
+	case "trace":
+		frames := make([]Object, 0, len(e.Err.Trace))
+		for i := len(e.Err.Trace) - 1; i >= 0; i-- {
+			frames = append(frames, newFrameHash(e.Err.Trace[i]))
+		}
+		return &Array{Value: frames}
+	case "value":
+		return e.Err.Value
+	}
+	return nil
+}
+
+func newFrameHash(frame Frame) *Hash {
+	pairs := map[HashKey]HashPair{}
+	for k, v := range map[string]string{"function": frame.Function, "position": frame.Pos.String()} {
+		key := &String{Value: k}
+		pairs[key.HashKey()] = HashPair{Key: key, Value: &String{Value: v}}
+	}
+	return &Hash{Pairs: pairs}
+}
+
+func flushRepeats(out *bytes.Buffer, repeated int) {
+	if repeated > 2 {
+		fmt.Fprintf(out, "  [Previous line repeated %d more times]\n", repeated-2)
+	}
+}
 
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	// root is the outermost scope, which holds the budget. Every scope keeps
+	// it so that finding the budget on each step does not walk the chain.
+	root   *Environment
+	budget *Budget
+}
+
+// Budget holds the limits of one evaluation and how much of them it has used.
+// A zero limit means no limit.
+type Budget struct {
+	Context   context.Context
+	MaxSteps  int
+	MaxDepth  int
+	MaxAllocs int
+
+	Steps  int
+	Depth  int
+	Allocs int
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{store: make(map[string]Object), outer: outer, root: outer.root}
 }
 
 func NewEnvironment() *Environment {
-	return &Environment{store: make(map[string]Object), outer: nil}
+	env := &Environment{store: make(map[string]Object), outer: nil}
+	env.root = env
+	return env
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -128,18 +381,48 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Set binds name in this scope. This is what def does: it creates a new
+// variable, shadowing any variable of the same name in an outer scope.
 func (e *Environment) Set(name string, value Object) Object {
 	e.store[name] = value
 	return value
 }
 
+// Exist reports whether name is bound in this scope, ignoring outer scopes.
 func (e *Environment) Exist(name string) bool {
 	_, ok := e.store[name]
 	return ok
 }
 
+// Budget returns the budget of the evaluation running in e. It is kept on the
+// outermost scope, which every function scope eventually encloses, so closures
+// created by an earlier evaluation are charged to the current one.
+func (e *Environment) Budget() *Budget {
+	return e.root.budget
+}
+
+// SetBudget attaches b to the outermost scope of e; nil removes the limits.
+func (e *Environment) SetBudget(b *Budget) {
+	e.root.budget = b
+}
+
+// Resolve returns the innermost scope, starting from e, in which name is
+// bound, or nil if it is not bound at all. Assignments update the variable in
+// the scope returned here, so a closure can change a captured variable.
+func (e *Environment) Resolve(name string) *Environment {
+	for env := e; env != nil; env = env.outer {
+		if env.Exist(name) {
+			return env
+		}
+	}
+	return nil
+}
+
 type Function struct {
+	Name       string // empty for anonymous functions
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -147,12 +430,8 @@ type Function struct {
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
 	out.WriteString("func(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.ParamList(f.Parameters, f.Defaults, f.Rest))
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
@@ -2,10 +2,12 @@ package monkey_parser
 
 import (
 	"fmt"
+	"math/big"
 	ast "myMonkey/monkey_ast"
 	lexer "myMonkey/monkey_lexer"
 	token "myMonkey/monkey_token"
 	"strconv"
+	"strings"
 )
 
 type (
@@ -14,67 +16,145 @@ type (
 	ledFn      func(ast.Expression) ast.Expression
 	Parser     struct {
 		l                   *lexer.Lexer
-		errors              []string
+		errors              []*ParseError
 		curToken, peekToken token.Token
 		nudFns              map[token.TokenType]nudFn
 		ledFns              map[token.TokenType]ledFn
+		loopDepth           int
+		inPattern           bool
+		panicking           bool
 	}
 )
 
+type ErrorKind string
+
+const (
+	UNEXPECTED_TOKEN ErrorKind = "UNEXPECTED_TOKEN"
+	MISSING_NUD      ErrorKind = "MISSING_NUD"
+	ILLEGAL_TOKEN    ErrorKind = "ILLEGAL_TOKEN"
+	INVALID_LITERAL  ErrorKind = "INVALID_LITERAL"
+	INVALID_TARGET   ErrorKind = "INVALID_TARGET"
+	MISPLACED_STMT   ErrorKind = "MISPLACED_STATEMENT"
+	INVALID_PARAM    ErrorKind = "INVALID_PARAMETER"
+)
+
+// ParseError describes a single syntax error. Expected lists the token types
+// that would have been accepted at Pos, Found is the token actually seen there.
+type ParseError struct {
+	Kind     ErrorKind
+	Pos      token.Position
+	Expected []token.TokenType
+	Found    token.Token
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// statementStarts are the tokens the parser resynchronizes on after an error.
+var statementStarts = map[token.TokenType]bool{
+	token.DEFINE:   true,
+	token.RETURN:   true,
+	token.LOOP:     true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+}
+
 const (
 	_ Precedence = iota
 	LOWEST
+	TERNARY
+	COALESCE
+	PIPE
+	LOGICALOR
+	LOGICALAND
 	EQUALS
 	LESSGREATER
+	BITOR
+	BITXOR
+	BITAND
 	SUM
 	PRODUCT
 	SHIFT
 	PREFIX
+	POWER
+	POSTFIX
 	CALL
 	INDEX
 	ASSIGN
 )
 
 var precedences = map[token.TokenType]Precedence{
-	token.EQ:       EQUALS,
-	token.NEQ:      EQUALS,
-	token.LT:       LESSGREATER,
-	token.LE:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.GE:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.MULTIPLY: PRODUCT,
-	token.DIVIDE:   PRODUCT,
-	token.LSHIFT:   SHIFT,
-	token.RSHIFT:   SHIFT,
-	token.LPAREN:   CALL,
-	token.ASSIGN:   ASSIGN,
-	token.LBRACKET: INDEX,
+	token.QUESTION:       TERNARY,
+	token.COALESCE:       COALESCE,
+	token.PIPE:           PIPE,
+	token.OR:             LOGICALOR,
+	token.AND:            LOGICALAND,
+	token.EQ:             EQUALS,
+	token.NEQ:            EQUALS,
+	token.LT:             LESSGREATER,
+	token.LE:             LESSGREATER,
+	token.GT:             LESSGREATER,
+	token.GE:             LESSGREATER,
+	token.VERTICAL:       BITOR,
+	token.BITXOR:         BITXOR,
+	token.BITAND:         BITAND,
+	token.PLUS:           SUM,
+	token.MINUS:          SUM,
+	token.MULTIPLY:       PRODUCT,
+	token.DIVIDE:         PRODUCT,
+	token.MODULO:         PRODUCT,
+	token.INTDIVIDE:      PRODUCT,
+	token.LSHIFT:         SHIFT,
+	token.RSHIFT:         SHIFT,
+	token.POWER:          POWER,
+	token.LPAREN:         CALL,
+	token.BUMPPLUS:       POSTFIX,
+	token.BUMPMINUS:      POSTFIX,
+	token.ASSIGN:         ASSIGN,
+	token.PLUSASSIGN:     ASSIGN,
+	token.MINUSASSIGN:    ASSIGN,
+	token.MULTIPLYASSIGN: ASSIGN,
+	token.DIVIDEASSIGN:   ASSIGN,
+	token.MODULOASSIGN:   ASSIGN,
+	token.LSHIFTASSIGN:   ASSIGN,
+	token.RSHIFTASSIGN:   ASSIGN,
+	token.LBRACKET:       INDEX,
+	token.SAFEINDEX:      INDEX,
 }
 
 func NewParser(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}, nudFns: map[token.TokenType]nudFn{}, ledFns: map[token.TokenType]ledFn{}}
+	p := &Parser{l: l, errors: []*ParseError{}, nudFns: map[token.TokenType]nudFn{}, ledFns: map[token.TokenType]ledFn{}}
 	p.registerNuds(p.parseIdent, token.IDENTIFIER)
-	p.registerNuds(p.parseDecimal, token.NUMBER)
+	p.registerNuds(p.parseNumber, token.NUMBER)
 	p.registerNuds(p.parseString, token.STRING)
 	p.registerNuds(p.parseGroup, token.LPAREN)
 	p.registerNuds(p.parseIf, token.IF)
+	p.registerNuds(p.parseMatch, token.MATCH)
+	p.registerNuds(p.parseTry, token.TRY)
 	p.registerNuds(p.parseFn, token.FUNCTION)
 	p.registerNuds(p.parseBoolean, token.TRUE, token.FALSE)
-	p.registerNuds(p.parsePrefix, token.REVERSE, token.MINUS, token.BUMPPLUS, token.BUMPMINUS)
+	p.registerNuds(p.parsePrefix, token.REVERSE, token.MINUS, token.BUMPPLUS, token.BUMPMINUS, token.BITNOT)
 	p.registerNuds(p.parseHash, token.LBRACE)
 	p.registerNuds(p.parseArray, token.LBRACKET)
+	p.registerNuds(p.parsePin, token.BITXOR)
 	p.registerLeds(p.parseCall, token.LPAREN)
-	p.registerLeds(p.parseAssign, token.ASSIGN)
-	p.registerLeds(p.parseInfix, token.EQ, token.NEQ, token.LT, token.LE, token.GT, token.GE, token.PLUS, token.MINUS, token.MULTIPLY, token.DIVIDE, token.LSHIFT, token.RSHIFT)
-	p.registerLeds(p.parseIndex, token.LBRACKET)
+	p.registerLeds(p.parseAssign, token.ASSIGN, token.PLUSASSIGN, token.MINUSASSIGN, token.MULTIPLYASSIGN, token.DIVIDEASSIGN,
+		token.MODULOASSIGN, token.LSHIFTASSIGN, token.RSHIFTASSIGN)
+	p.registerLeds(p.parsePostfix, token.BUMPPLUS, token.BUMPMINUS)
+	p.registerLeds(p.parseInfix, token.EQ, token.NEQ, token.LT, token.LE, token.GT, token.GE, token.PLUS, token.MINUS, token.MULTIPLY, token.DIVIDE, token.MODULO, token.INTDIVIDE, token.POWER,
+		token.LSHIFT, token.RSHIFT, token.BITAND, token.VERTICAL, token.BITXOR)
+	p.registerLeds(p.parseIndex, token.LBRACKET, token.SAFEINDEX)
+	p.registerLeds(p.parseLogical, token.AND, token.OR, token.COALESCE)
+	p.registerLeds(p.parseTernary, token.QUESTION)
+	p.registerLeds(p.parsePipe, token.PIPE)
 	p.nextToken()
 	p.nextToken()
 	return p
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
@@ -123,14 +203,69 @@ func (p *Parser) expectNext(t token.TokenType) bool {
 	}
 }
 
+// addError records err and enters panic mode, in which further errors are
+// dropped until the parser has resynchronized at a statement boundary.
+func (p *Parser) addError(err *ParseError) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, err)
+}
+
+func (p *Parser) errorAt(kind ErrorKind, tok token.Token, format string, a ...interface{}) {
+	p.addError(&ParseError{Kind: kind, Pos: tok.Pos, Found: tok, Message: fmt.Sprintf(format, a...)})
+}
+
+// expectCur moves past the current token if it is the optional terminator t
+// consumed by the previous clause, otherwise the next token is unexpected.
+func (p *Parser) expectCur(t token.TokenType) bool {
+	if !p.curTokenIs(t) {
+		p.nextError(t)
+		return false
+	}
+	p.nextToken()
+	return true
+}
+
+func (p *Parser) expectedError(t token.TokenType, found token.Token) {
+	p.addError(&ParseError{
+		Kind:     UNEXPECTED_TOKEN,
+		Pos:      found.Pos,
+		Expected: []token.TokenType{t},
+		Found:    found,
+		Message:  fmt.Sprintf("Expected next token to be %s, got %s instead", t, found.Type),
+	})
+}
+
 func (p *Parser) nextError(t token.TokenType) {
-	msg := fmt.Sprintf("Expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.expectedError(t, p.peekToken)
+}
+
+func (p *Parser) noNudError(tok token.Token) {
+	if tok.Type == token.ILLEGAL {
+		for _, err := range p.l.Errors() {
+			if err.Pos == tok.Pos {
+				p.errorAt(ILLEGAL_TOKEN, tok, "%s", err.Message)
+				return
+			}
+		}
+		p.errorAt(ILLEGAL_TOKEN, tok, "Illegal token %q", tok.Literal)
+		return
+	}
+	p.errorAt(MISSING_NUD, tok, "No null denotation function for %s found", tok.Type)
 }
 
-func (p *Parser) noNudError(tt token.TokenType) {
-	msg := fmt.Sprintf("No null denotation function for %s found", tt)
-	p.errors = append(p.errors, msg)
+// synchronize skips tokens until the end of the broken statement: a `;` or
+// `}`, the token before a statement keyword, or EOF.
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		if statementStarts[p.peekToken.Type] {
+			break
+		}
+		p.nextToken()
+	}
+	p.panicking = false
 }
 
 func (p *Parser) Parse() *ast.Program {
@@ -138,7 +273,9 @@ func (p *Parser) Parse() *ast.Program {
 	program.Statements = []ast.Statement{}
 	for p.curToken.Type != token.EOF {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -153,7 +290,15 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.RETURN:
 		return p.parseReturn()
 	case token.LOOP:
-		return p.parseLoop()
+		if loop := p.parseLoop(); loop != nil {
+			return loop
+		}
+		// not a typed nil: a loop dropped for a bad header leaves no panic
+		return nil
+	case token.BREAK:
+		return p.parseBreak()
+	case token.CONTINUE:
+		return p.parseContinue()
 	default:
 		return p.parseExpression()
 	}
@@ -161,26 +306,124 @@ func (p *Parser) parseStatement() ast.Statement {
 
 func (p *Parser) parseDefinition() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
-	if !p.expectNext(token.IDENTIFIER) {
-		return nil
+	if p.nextTokenIs(token.LBRACKET) || p.nextTokenIs(token.LBRACE) {
+		p.nextToken()
+		if stmt.Pattern = p.parsePattern(); stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectNext(token.IDENTIFIER) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	if !p.expectNext(token.ASSIGN) {
 		return nil
 	}
 	p.nextToken()
 	stmt.Value = p.prattParser(LOWEST)
-	for !p.curTokenIs(token.SEMICOLON) {
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
+		fn.Name = stmt.Name.Value
+	}
+	if p.nextTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
 }
 
+// parsePattern parses the target of a destructuring def, starting at its first
+// token.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENTIFIER:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		p.errorAt(INVALID_TARGET, p.curToken, "Expected an identifier, array or hash pattern, got %s", p.curToken.Literal)
+		return nil
+	}
+}
+
+func (p *Parser) parsePatternElement() *ast.PatternElement {
+	target := p.parsePattern()
+	if target == nil {
+		return nil
+	}
+	elem := &ast.PatternElement{Target: target}
+	if p.nextTokenIs(token.ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+		elem.Default = p.prattParser(LOWEST)
+	}
+	return elem
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+	for !p.nextTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectNext(token.IDENTIFIER) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+		elem := p.parsePatternElement()
+		if elem == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, elem)
+		if !p.nextTokenIs(token.RBRACKET) && !p.expectNext(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectNext(token.RBRACKET) {
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+	for !p.nextTokenIs(token.RBRACE) {
+		p.nextToken()
+		entry := &ast.HashPatternEntry{Token: p.curToken, Key: p.curToken.Literal}
+		switch {
+		case p.curTokenIs(token.IDENTIFIER) && !p.nextTokenIs(token.COLON):
+			entry.Value = p.parsePatternElement()
+		case p.curTokenIs(token.IDENTIFIER) || p.curTokenIs(token.STRING):
+			if !p.expectNext(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			entry.Value = p.parsePatternElement()
+		default:
+			p.expectedError(token.IDENTIFIER, p.curToken)
+			return nil
+		}
+		if entry.Value == nil {
+			return nil
+		}
+		pattern.Entries = append(pattern.Entries, entry)
+		if !p.nextTokenIs(token.RBRACE) && !p.expectNext(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectNext(token.RBRACE) {
+		return nil
+	}
+	return pattern
+}
+
 func (p *Parser) parseReturn() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
 	stmt.ReturnValue = p.prattParser(LOWEST)
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.nextTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -201,29 +444,100 @@ func (p *Parser) parseLoop() *ast.LoopStatement {
 		return nil
 	}
 	p.nextToken()
+	if !p.parseLoopHeader(loop) {
+		if p.skipLoopHeader() {
+			// the body is still parsed for its own errors, then dropped
+			p.panicking = false
+			p.parseLoopBody()
+		}
+		return nil
+	}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	loop.Body = p.parseLoopBody()
+	return loop
+}
+
+// parseLoopHeader parses the part of a loop between its parentheses, up to
+// the closing `)`. It reports whether it did so without errors.
+func (p *Parser) parseLoopHeader(loop *ast.LoopStatement) bool {
 	if loop.Token.Literal == "for" {
+		if !p.curTokenIs(token.DEFINE) {
+			p.errorAt(UNEXPECTED_TOKEN, p.curToken, "Expected for loop to start with %s, got %s instead", token.DEFINE, p.curToken.Type)
+			return false
+		}
 		loop.Initial = p.parseDefinition()
-		p.nextToken()
+		if p.panicking || !p.expectCur(token.SEMICOLON) {
+			return false
+		}
 		loop.Condition = p.parseExpression()
-		p.nextToken()
+		if p.panicking || !p.expectCur(token.SEMICOLON) {
+			return false
+		}
 		loop.AfterBlock = p.parseExpression()
 	} else {
 		loop.Condition = p.parseExpression()
 	}
-	if !p.expectNext(token.RPAREN) {
-		return nil
+	return !p.panicking && p.expectNext(token.RPAREN)
+}
+
+// skipLoopHeader moves past the rest of a loop header that failed to parse,
+// so that the `;`s in a for header are not taken for the ends of statements.
+// It reports whether it stopped on the `{` of the loop body.
+func (p *Parser) skipLoopHeader() bool {
+	depth := 1
+	for !p.curTokenIs(token.LBRACE) && !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LPAREN:
+			depth++
+		case token.RPAREN:
+			if depth--; depth == 0 {
+				if !p.nextTokenIs(token.LBRACE) {
+					return false
+				}
+				p.nextToken()
+				return true
+			}
+		}
+		p.nextToken()
 	}
-	if !p.expectNext(token.LBRACE) {
-		return nil
+	return p.curTokenIs(token.LBRACE)
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	body := p.parseBlock()
+	p.loopDepth--
+	return body
+}
+
+func (p *Parser) parseBreak() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.errorAt(MISPLACED_STMT, stmt.Token, "break statement outside of a loop")
 	}
-	loop.Body = p.parseBlock()
-	return loop
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseContinue() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.errorAt(MISPLACED_STMT, stmt.Token, "continue statement outside of a loop")
+	}
+	if p.nextTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
 }
 
 func (p *Parser) prattParser(pre Precedence) ast.Expression {
 	nud := p.nudFns[p.curToken.Type]
 	if nud == nil {
-		p.noNudError(p.curToken.Type)
+		p.noNudError(p.curToken)
 		return nil
 	}
 	leftExp := nud()
@@ -242,16 +556,35 @@ func (p *Parser) parseIdent() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
-func (p *Parser) parseDecimal() ast.Expression {
-	dl := &ast.DecimalLiteral{Token: p.curToken}
-	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+// parseNumber turns a literal already validated by the lexer, which may carry
+// a 0x/0o/0b prefix and `_` digit separators, into an IntegerLiteral (or a
+// BigIntLiteral if it does not fit into an int64) or, if it has a fraction or
+// an exponent, a DecimalLiteral.
+func (p *Parser) parseNumber() ast.Expression {
+	literal := strings.ReplaceAll(p.curToken.Literal, "_", "")
+	base := 10
+	if len(literal) > 2 && literal[0] == '0' && strings.ContainsRune("xXoObB", rune(literal[1])) {
+		base = 0
+	} else if strings.ContainsAny(literal, ".eE") {
+		base = -1
+	}
+	if base >= 0 {
+		if value, err := strconv.ParseInt(literal, base, 64); err == nil {
+			return &ast.IntegerLiteral{Token: p.curToken, Value: value}
+		}
+		value, ok := new(big.Int).SetString(literal, base)
+		if !ok {
+			p.errorAt(INVALID_LITERAL, p.curToken, "Could not parse %s as integer", p.curToken.Literal)
+			return nil
+		}
+		return &ast.BigIntLiteral{Token: p.curToken, Value: value}
+	}
+	value, err := strconv.ParseFloat(literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("Could not parse %s as decimal", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(INVALID_LITERAL, p.curToken, "Could not parse %s as decimal", p.curToken.Literal)
 		return nil
 	}
-	dl.Value = value
-	return dl
+	return &ast.DecimalLiteral{Token: p.curToken, Value: value}
 }
 
 func (p *Parser) parsePrefix() ast.Expression {
@@ -261,9 +594,64 @@ func (p *Parser) parsePrefix() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parsePostfix(left ast.Expression) ast.Expression {
+	if !p.checkTarget(left) {
+		return nil
+	}
+	return &ast.PostfixExpression{Token: p.curToken, Left: left, Operator: p.curToken.Literal}
+}
+
 func (p *Parser) parseInfix(left ast.Expression) ast.Expression {
 	exp := &ast.InfixExpression{Token: p.curToken, Operator: p.curToken.Literal, Left: left}
 	pre := p.curPrecedence()
+	if p.curToken.Type == token.POWER {
+		// ** is right-associative: 2 ** 3 ** 2 is 2 ** (3 ** 2).
+		pre--
+	}
+	p.nextToken()
+	exp.Right = p.prattParser(pre)
+	return exp
+}
+
+// parseTernary parses `cond ? a : b`. The alternative is parsed at the lowest
+// precedence so that a ? b : c ? d : e groups as a ? b : (c ? d : e).
+func (p *Parser) parseTernary(cond ast.Expression) ast.Expression {
+	exp := &ast.TernaryExpression{Token: p.curToken, Condition: cond}
+	p.nextToken()
+	exp.Consequence = p.prattParser(LOWEST)
+	if !p.expectNext(token.COLON) {
+		return nil
+	}
+	p.nextToken()
+	exp.Alternative = p.prattParser(LOWEST)
+	return exp
+}
+
+// parsePipe desugars `x |> f(y)` into the call f(x, y), and `x |> f` where
+// f is not a call into f(x). The right side is only a call or a callee, so
+// in `x |> f == y` the comparison applies to the result of the call.
+func (p *Parser) parsePipe(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	p.nextToken()
+	start := p.curToken
+	right := p.prattParser(POSTFIX)
+	switch right := right.(type) {
+	case nil:
+		return nil
+	case *ast.CallExpression:
+		right.Arguments = append([]ast.Expression{left}, right.Arguments...)
+		return right
+	case *ast.Identifier, *ast.IndexExpression, *ast.FunctionLiteral:
+		return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+	default:
+		p.errorAt(UNEXPECTED_TOKEN, start, "Expected a function or a call after |>, got %s", right.String())
+		return nil
+	}
+}
+
+func (p *Parser) parseLogical(left ast.Expression) ast.Expression {
+	exp := &ast.LogicalExpression{Token: p.curToken, Operator: p.curToken.Literal, Left: left}
+	pre := p.curPrecedence()
 	p.nextToken()
 	exp.Right = p.prattParser(pre)
 	return exp
@@ -273,13 +661,84 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+// parseGroup parses a parenthesized expression, or an arrow function such as
+// (a, b = 1, ...rest) => a + b. The two are only told apart once the closing
+// parenthesis is followed by =>, so each element is parsed as an expression
+// and converted into a parameter afterwards.
 func (p *Parser) parseGroup() ast.Expression {
-	p.nextToken()
-	exp := p.prattParser(LOWEST)
+	fn := &ast.FunctionLiteral{Token: p.curToken}
+	if p.nextTokenIs(token.RPAREN) {
+		p.nextToken()
+		if !p.expectNext(token.ARROW) {
+			return nil
+		}
+		return p.parseArrowBody(fn)
+	}
+	var items []ast.Expression
+	for {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if fn.Rest = p.parseRestParam(); fn.Rest == nil {
+				return nil
+			}
+			break
+		}
+		items = append(items, p.prattParser(LOWEST))
+		if !p.nextTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
 	if !p.expectNext(token.RPAREN) {
 		return nil
 	}
-	return exp
+	if len(items) == 1 && fn.Rest == nil && !p.nextTokenIs(token.ARROW) {
+		return items[0]
+	}
+	if !p.expectNext(token.ARROW) {
+		return nil
+	}
+	for _, item := range items {
+		switch item := item.(type) {
+		case *ast.Identifier:
+			if !p.addParam(fn, item, nil) {
+				return nil
+			}
+		case *ast.AssignExpression:
+			name, ok := item.Target.(*ast.Identifier)
+			if ok && item.Token.Type == token.ASSIGN {
+				if !p.addParam(fn, name, item.Value) {
+					return nil
+				}
+				continue
+			}
+			p.errorAt(INVALID_PARAM, item.Token, "Expected a parameter, got %s", item.String())
+			return nil
+		case nil:
+			return nil
+		default:
+			p.errorAt(INVALID_PARAM, fn.Token, "Expected a parameter, got %s", item.String())
+			return nil
+		}
+	}
+	return p.parseArrowBody(fn)
+}
+
+// parseArrowBody parses what follows the => of an arrow function: either a
+// block or a single expression, which becomes the function's result.
+func (p *Parser) parseArrowBody(fn *ast.FunctionLiteral) ast.Expression {
+	p.nextToken()
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+	if p.curTokenIs(token.LBRACE) {
+		fn.Body = p.parseBlock()
+		return fn
+	}
+	tok := p.curToken
+	body := p.prattParser(LOWEST)
+	fn.Body = &ast.BlockStatement{Token: tok, Statements: []ast.Statement{&ast.ExpressionStatement{Token: tok, Expression: body}}}
+	return fn
 }
 
 func (p *Parser) parseBlock() *ast.BlockStatement {
@@ -288,11 +747,19 @@ func (p *Parser) parseBlock() *ast.BlockStatement {
 	p.nextToken()
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize()
+			if p.curTokenIs(token.RBRACE) {
+				break
+			}
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) {
+		p.expectedError(token.RBRACE, p.curToken)
+	}
 	return block
 }
 
@@ -312,6 +779,15 @@ func (p *Parser) parseIf() ast.Expression {
 	exp.True = p.parseBlock()
 	if p.nextTokenIs(token.ELSE) {
 		p.nextToken()
+		if p.nextTokenIs(token.IF) {
+			p.nextToken()
+			elseIf, ok := p.parseIf().(*ast.ConditionExpression)
+			if !ok {
+				return nil
+			}
+			exp.ElseIf = elseIf
+			return exp
+		}
 		if !p.expectNext(token.LBRACE) {
 			return nil
 		}
@@ -320,37 +796,195 @@ func (p *Parser) parseIf() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseTry() ast.Expression {
+	exp := &ast.TryExpression{Token: p.curToken}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	exp.Block = p.parseBlock()
+	if p.nextTokenIs(token.CATCH) {
+		p.nextToken()
+		if p.nextTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectNext(token.IDENTIFIER) {
+				return nil
+			}
+			exp.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectNext(token.RPAREN) {
+				return nil
+			}
+		}
+		if !p.expectNext(token.LBRACE) {
+			return nil
+		}
+		exp.Catch = p.parseBlock()
+	}
+	if p.nextTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectNext(token.LBRACE) {
+			return nil
+		}
+		exp.Finally = p.parseBlock()
+	}
+	if exp.Catch == nil && exp.Finally == nil {
+		p.addError(&ParseError{
+			Kind:     UNEXPECTED_TOKEN,
+			Pos:      p.peekToken.Pos,
+			Expected: []token.TokenType{token.CATCH, token.FINALLY},
+			Found:    p.peekToken,
+			Message:  fmt.Sprintf("Expected catch or finally after try block, got %s instead", p.peekToken.Type),
+		})
+		return nil
+	}
+	return exp
+}
+
+func (p *Parser) parseMatch() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.curToken}
+	if !p.expectNext(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	exp.Value = p.prattParser(LOWEST)
+	if !p.expectNext(token.RPAREN) {
+		return nil
+	}
+	if !p.expectNext(token.LBRACE) {
+		return nil
+	}
+	for !p.nextTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		exp.Arms = append(exp.Arms, arm)
+		// Arms are separated by commas, which may be left out after a block.
+		if p.nextTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.nextTokenIs(token.RBRACE) && !p.curTokenIs(token.RBRACE) {
+			p.nextError(token.COMMA)
+			return nil
+		}
+	}
+	p.nextToken()
+	return exp
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: p.curToken}
+	p.inPattern = true
+	arm.Pattern = p.prattParser(LOWEST)
+	p.inPattern = false
+	if p.nextTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.prattParser(LOWEST)
+	}
+	if !p.expectNext(token.ARROW) {
+		return nil
+	}
+	p.nextToken()
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlock()
+		return arm
+	}
+	tok := p.curToken
+	value := p.prattParser(LOWEST)
+	arm.Body = &ast.BlockStatement{Token: tok, Statements: []ast.Statement{&ast.ExpressionStatement{Token: tok, Expression: value}}}
+	return arm
+}
+
+// parsePin parses `^name`, which is only meaningful in a match pattern.
+func (p *Parser) parsePin() ast.Expression {
+	pin := &ast.PinExpression{Token: p.curToken}
+	if !p.inPattern {
+		p.errorAt(MISPLACED_STMT, pin.Token, "pin ^ outside of a match pattern")
+	}
+	if !p.expectNext(token.IDENTIFIER) {
+		return nil
+	}
+	pin.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return pin
+}
+
 func (p *Parser) parseFn() ast.Expression {
 	fn := &ast.FunctionLiteral{Token: p.curToken}
 	if !p.expectNext(token.LPAREN) {
 		return nil
 	}
-	fn.Parameters = p.parseFnParams()
+	if !p.parseFnParams(fn) {
+		return nil
+	}
 	if !p.expectNext(token.LBRACE) {
 		return nil
 	}
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	fn.Body = p.parseBlock()
+	p.loopDepth = loopDepth
 	return fn
 }
 
-func (p *Parser) parseFnParams() []*ast.Identifier {
-	idents := []*ast.Identifier{}
-	p.nextToken()
-	if p.curTokenIs(token.RPAREN) {
-		return idents
-	}
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	idents = append(idents, ident)
-	for p.nextTokenIs(token.COMMA) {
+// parseFnParams parses `(a, b = 1, ...rest)` into fn. Parameters with a default
+// must come after those without, and the rest parameter must be last.
+func (p *Parser) parseFnParams(fn *ast.FunctionLiteral) bool {
+	if p.nextTokenIs(token.RPAREN) {
 		p.nextToken()
+		return true
+	}
+	for {
 		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if fn.Rest = p.parseRestParam(); fn.Rest == nil {
+				return false
+			}
+			break
+		}
+		if !p.curTokenIs(token.IDENTIFIER) {
+			p.expectedError(token.IDENTIFIER, p.curToken)
+			return false
+		}
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		idents = append(idents, ident)
+		var def ast.Expression
+		if p.nextTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			def = p.prattParser(LOWEST)
+		}
+		if !p.addParam(fn, ident, def) {
+			return false
+		}
+		if !p.nextTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
-	if !p.expectNext(token.RPAREN) {
+	return p.expectNext(token.RPAREN)
+}
+
+// parseRestParam parses `...name`, starting at the ellipsis.
+func (p *Parser) parseRestParam() *ast.Identifier {
+	if !p.expectNext(token.IDENTIFIER) {
+		return nil
+	}
+	rest := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.nextTokenIs(token.COMMA) {
+		p.errorAt(INVALID_PARAM, rest.Token, "rest parameter %s must be the last parameter", rest.Value)
 		return nil
 	}
-	return idents
+	return rest
+}
+
+func (p *Parser) addParam(fn *ast.FunctionLiteral, ident *ast.Identifier, def ast.Expression) bool {
+	n := len(fn.Parameters)
+	if def == nil && n > 0 && fn.Defaults[n-1] != nil {
+		p.errorAt(INVALID_PARAM, ident.Token, "parameter %s without a default follows a parameter with one", ident.Value)
+		return false
+	}
+	fn.Parameters = append(fn.Parameters, ident)
+	fn.Defaults = append(fn.Defaults, def)
+	return true
 }
 
 func (p *Parser) parseCall(fn ast.Expression) ast.Expression {
@@ -366,7 +1000,7 @@ func (p *Parser) parseArray() ast.Expression {
 }
 
 func (p *Parser) parseIndex(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left, Safe: p.curTokenIs(token.SAFEINDEX)}
 	p.nextToken()
 	exp.Index = p.prattParser(LOWEST)
 	if !p.expectNext(token.RBRACKET) {
@@ -394,18 +1028,28 @@ func (p *Parser) parseExpList(end token.TokenType) []ast.Expression {
 }
 
 func (p *Parser) parseAssign(left ast.Expression) ast.Expression {
-	name, ok := left.(*ast.Identifier)
-	if !ok {
-		msg := fmt.Sprintf("Expected an identifier, got %s", left.String())
-		p.errors = append(p.errors, msg)
+	if !p.checkTarget(left) {
 		return nil
 	}
-	assign := &ast.AssignExpression{Token: p.curToken, Name: name}
+	assign := &ast.AssignExpression{Token: p.curToken, Target: left}
 	p.nextToken()
 	assign.Value = p.prattParser(LOWEST)
 	return assign
 }
 
+// checkTarget reports whether exp can be assigned to, i.e. whether it is a
+// variable or an index expression such as a[1]["x"].
+func (p *Parser) checkTarget(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return true
+	case nil:
+		return false
+	}
+	p.errorAt(INVALID_TARGET, p.curToken, "Expected an identifier or index expression, got %s", exp.String())
+	return false
+}
+
 func (p *Parser) parseString() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -422,6 +1066,7 @@ func (p *Parser) parseHash() ast.Expression {
 		p.nextToken()
 		v := p.prattParser(LOWEST)
 		hash.Pairs[k] = v
+		hash.Keys = append(hash.Keys, k)
 		if !p.nextTokenIs(token.RBRACE) && !p.expectNext(token.COMMA) {
 			return nil
 		}
@@ -0,0 +1,221 @@
+package monkey_parser
+
+import (
+	lexer "myMonkey/monkey_lexer"
+	token "myMonkey/monkey_token"
+	"testing"
+)
+
+func TestParseErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		program    string
+		errorCount int
+	}{
+		{"def a = 5", "def a = 5;", 0},
+		{"ret", "", 1},
+		{"def = 5; def b = ; 1 + ; def c = 3;", "def c = 3;", 3},
+		{"def f = func(x) { def = 1; ret x + ; }; f(2", "def f = func(x) {};", 3},
+		{"if (x { 1 } def y = 2;", "def y = 2;", 1},
+		{") ) ) def x = 1;", "def x = 1;", 1},
+		{"def f = func() { 1;", "", 1},
+		{"for (;;) {}", "", 1},
+		{"for (;;) { def a = 1; } def b = 2;", "def b = 2;", 1},
+		{"def f = func() { for (def i = ; i < 3; i++) { i; } ret 1; };", "def f = func() {ret 1;};", 1},
+		{"while (x { def a = ; } def y = 2;", "def y = 2;", 2},
+	}
+	for _, test := range tests {
+		p := NewParser(lexer.NewLexer(test.input))
+		program := p.Parse()
+		if len(p.Errors()) != test.errorCount {
+			t.Errorf("%q: wrong number of errors. got=%d (%v), want=%d", test.input, len(p.Errors()), p.Errors(), test.errorCount)
+		}
+		if program.String() != test.program {
+			t.Errorf("%q: wrong program. got=%q, want=%q", test.input, program.String(), test.program)
+		}
+	}
+}
+
+func TestParseErrorDetails(t *testing.T) {
+	p := NewParser(lexer.NewFileLexer("test.mk", "def x = 1;\nif (x { 1 }"))
+	p.Parse()
+	if len(p.Errors()) != 1 {
+		t.Fatalf("wrong number of errors. got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+	err := p.Errors()[0]
+	if err.Kind != UNEXPECTED_TOKEN {
+		t.Errorf("wrong kind. got=%s", err.Kind)
+	}
+	if len(err.Expected) != 1 || err.Expected[0] != token.RPAREN {
+		t.Errorf("wrong expected tokens. got=%v", err.Expected)
+	}
+	if err.Found.Type != token.LBRACE {
+		t.Errorf("wrong found token. got=%s", err.Found.Type)
+	}
+	if err.Error() != "test.mk:2:7: Expected next token to be ), got { instead" {
+		t.Errorf("wrong message. got=%q", err.Error())
+	}
+}
+
+func TestIllegalTokenError(t *testing.T) {
+	p := NewParser(lexer.NewLexer("def x = 1; /* open"))
+	p.Parse()
+	if len(p.Errors()) != 1 {
+		t.Fatalf("wrong number of errors. got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+	err := p.Errors()[0]
+	if err.Kind != ILLEGAL_TOKEN || err.Error() != "1:12: unterminated block comment" {
+		t.Errorf("wrong error. got=%s %q", err.Kind, err.Error())
+	}
+}
+
+func TestBreakOutsideLoop(t *testing.T) {
+	tests := []string{
+		"break;",
+		"continue;",
+		"if(true){break;}",
+		"while(true){def f=func(){break;};}",
+	}
+	for _, input := range tests {
+		p := NewParser(lexer.NewLexer(input))
+		p.Parse()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", input)
+		}
+	}
+}
+
+func TestPostfixTarget(t *testing.T) {
+	p := NewParser(lexer.NewLexer("x++; 5++;"))
+	program := p.Parse()
+	if len(p.Errors()) != 1 {
+		t.Fatalf("wrong number of errors. got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+	if err := p.Errors()[0]; err.Kind != INVALID_TARGET || err.Error() != "1:7: Expected an identifier or index expression, got 5" {
+		t.Errorf("wrong error. got=%s %q", err.Kind, err.Error())
+	}
+	if got := program.Statements[0].String(); got != "(x++)" {
+		t.Errorf("wrong postfix expression. got=%q", got)
+	}
+}
+
+func TestAssignTarget(t *testing.T) {
+	p := NewParser(lexer.NewLexer(`a[1]["x"] = 2; f() = 3;`))
+	program := p.Parse()
+	if len(p.Errors()) != 1 {
+		t.Fatalf("wrong number of errors. got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+	if err := p.Errors()[0]; err.Kind != INVALID_TARGET || err.Error() != "1:20: Expected an identifier or index expression, got f()" {
+		t.Errorf("wrong error. got=%s %q", err.Kind, err.Error())
+	}
+	if got := program.Statements[0].String(); got != "((a[1])[x]) = 2" {
+		t.Errorf("wrong assignment. got=%q", got)
+	}
+}
+
+func TestMatchAndElseIf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (a) { 1 } else if (b) { 2 } else { 3 }", "ifa {1}else ifb {2}else {3}"},
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+		{"a || b ? c ?? d : e", "((a || b) ? (c ?? d) : e)"},
+		{"x = a ? 1 : 2", "x = (a ? 1 : 2)"},
+		{"h?.[k][j]", "((h?.[k])[j])"},
+		{"x ?[1] : 2", "(x ? [1] : 2)"},
+		{"x ?[1][0] : [2]", "(x ? ([1][0]) : [2])"},
+		{"x |> f(y) |> g", "g(f(x, y))"},
+		{"a || b |> f", "f((a || b))"},
+		{"a |> f ?? b", "(f(a) ?? b)"},
+		{"x |> f == y", "(f(x) == y)"},
+		{"x |> f + 1", "(f(x) + 1)"},
+		{"x |> f(y) * 2", "(f(x, y) * 2)"},
+		{"x |> h[k](y)", "(h[k])(x, y)"},
+		{"(a, b = 1, ...c) => a + b", "(a, b = 1, ...c) => {(a + b)}"},
+		{"func(a, b = 1, ...c) { a }", "func(a, b = 1, ...c) {a}"},
+		{"(a)", "a"},
+		{"def [a, b = 1, ...c] = x;", "def [a, b = 1, ...c] = x;"},
+		{`def {name, age: years = 0, "k": [z]} = x;`, "def {name, age: years = 0, k: [z]} = x;"},
+		{"match (x) { 1 => a, [y, _] if y > 0 => { y }, _ => b, }", "match(x) {1 => {a}, [y, _] if (y > 0) => {y}, _ => {b}}"},
+		{"try { a } catch (e) { b } finally { c }", "try {a} catch (e) {b} finally {c}"},
+		{"try { a } catch { b }", "try {a} catch {b}"},
+		{"match (x) { [^a, b] => b, ^c => c }", "match(x) {[^a, b] => {b}, ^c => {c}}"},
+		{`{"c": 1, "a": 2, "b": 3}`, "{c: 1,a: 2,b: 3}"},
+		{"try { a } finally { c }", "try {a} finally {c}"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.Parse()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%s: unexpected errors: %v", tt.input, p.Errors())
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+
+	p := NewParser(lexer.NewLexer("match (x) { 1 => a 2 => b }"))
+	p.Parse()
+	if len(p.Errors()) == 0 || p.Errors()[0].Error() != "1:20: Expected next token to be ,, got DECIMAL instead" {
+		t.Errorf("wrong errors for missing comma. got=%v", p.Errors())
+	}
+
+	p = NewParser(lexer.NewLexer("def x = ^a;"))
+	p.Parse()
+	if len(p.Errors()) == 0 || p.Errors()[0].Kind != MISPLACED_STMT || p.Errors()[0].Error() != "1:9: pin ^ outside of a match pattern" {
+		t.Errorf("wrong errors for a pin outside of a pattern. got=%v", p.Errors())
+	}
+	p = NewParser(lexer.NewLexer("match (x) { a if a == ^b => 1 }"))
+	p.Parse()
+	if len(p.Errors()) == 0 || p.Errors()[0].Kind != MISPLACED_STMT {
+		t.Errorf("wrong errors for a pin in a guard. got=%v", p.Errors())
+	}
+
+	p = NewParser(lexer.NewLexer("try { a };"))
+	p.Parse()
+	if len(p.Errors()) == 0 || p.Errors()[0].Error() != "1:10: Expected catch or finally after try block, got ; instead" {
+		t.Errorf("wrong errors for bare try. got=%v", p.Errors())
+	}
+}
+
+func TestParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"func(a = 1, b) { a }", "1:13: parameter b without a default follows a parameter with one"},
+		{"func(...a, b) { a }", "1:9: rest parameter a must be the last parameter"},
+		{"func(1) { 1 }", "1:6: Expected next token to be IDENT, got DECIMAL instead"},
+		{"(a + 1) => a", "1:1: Expected a parameter, got (a + 1)"},
+		{"(a, b)", "1:7: Expected next token to be =>, got EOF instead"},
+		{"def [a, 1] = x;", "1:9: Expected an identifier, array or hash pattern, got 1"},
+		{"def [...r, a] = x;", "1:10: Expected next token to be ], got , instead"},
+		{`def {"k"} = x;`, "1:9: Expected next token to be :, got } instead"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.Parse()
+		if len(p.Errors()) == 0 || p.Errors()[0].Error() != tt.expected {
+			t.Errorf("%s: wrong errors. got=%v, want %q", tt.input, p.Errors(), tt.expected)
+		}
+	}
+}
+
+func TestPipeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 |> 3", "1:6: Expected a function or a call after |>, got 3"},
+		{"x |> -f", "1:6: Expected a function or a call after |>, got (-f)"},
+		{`x |> "f"`, "1:6: Expected a function or a call after |>, got f"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.Parse()
+		if len(p.Errors()) == 0 || p.Errors()[0].Error() != tt.expected {
+			t.Errorf("%s: wrong errors. got=%v, want %q", tt.input, p.Errors(), tt.expected)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package monkey_repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	evaluator "myMonkey/monkey_evaluator"
 	lexer "myMonkey/monkey_lexer"
 	object "myMonkey/monkey_object"
 	parser "myMonkey/monkey_parser"
+	"os"
 )
 
 const (
@@ -41,6 +43,14 @@ func Start(read io.Reader, write io.Writer) error {
 			continue
 		}
 		evaluated := evaluator.Eval(pro, env)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			_, err = fmt.Fprintf(write, WRITEPROMPT, i)
+			if err != nil {
+				return fmt.Errorf("%d: write WRITEPROMPT failed: %v", i, err)
+			}
+			io.WriteString(write, "\n"+errObj.Traceback())
+			continue
+		}
 		if evaluated != nil && evaluated != evaluator.NULL {
 			_, err = fmt.Fprintf(write, WRITEPROMPT, i)
 			if err != nil {
@@ -53,9 +63,33 @@ func Start(read io.Reader, write io.Writer) error {
 	return nil
 }
 
-func printParserErrors(write io.Writer, errors []string) {
+// ErrScriptFailed is returned by RunFile when the script had syntax errors or
+// raised an error, after the details have been printed.
+var ErrScriptFailed = errors.New("script failed")
+
+// RunFile runs the script at path. Parser errors and runtime tracebacks are
+// written to write.
+func RunFile(path string, write io.Writer) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p := parser.NewParser(lexer.NewFileLexer(path, string(src)))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		printParserErrors(write, p.Errors())
+		return ErrScriptFailed
+	}
+	if errObj, ok := evaluator.Eval(program, object.NewEnvironment()).(*object.Error); ok {
+		io.WriteString(write, errObj.Traceback())
+		return ErrScriptFailed
+	}
+	return nil
+}
+
+func printParserErrors(write io.Writer, errors []*parser.ParseError) {
 	io.WriteString(write, "Whoops! We've encountered some errors!\nParser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(write, "\t"+msg+"\n")
+	for _, err := range errors {
+		io.WriteString(write, "\t"+err.Error()+"\n")
 	}
 }
@@ -1,22 +1,54 @@
 package monkey_token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position locates a token in the source. Line and Column start at 1,
+// the zero value means the position is unknown.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.File != "" {
+			return p.File
+		}
+		return "-"
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
 }
 
 var keywords = map[string]TokenType{
-	"func":  FUNCTION,
-	"def":   DEFINE,
-	"true":  TRUE,
-	"false": FALSE,
-	"if":    IF,
-	"else":  ELSE,
-	"ret":   RETURN,
-	"for":   LOOP,
-	"while": LOOP,
+	"func":     FUNCTION,
+	"def":      DEFINE,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"ret":      RETURN,
+	"for":      LOOP,
+	"while":    LOOP,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"match":    MATCH,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
 }
 
 func LookupKeyword(keyword string) TokenType {
@@ -29,21 +61,36 @@ func LookupKeyword(keyword string) TokenType {
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
 	IDENTIFIER = "IDENT"
 	NUMBER     = "DECIMAL"
 
-	ASSIGN    = "="
-	PLUS      = "+"
-	MINUS     = "-"
-	REVERSE   = "!"
-	MULTIPLY  = "*"
-	DIVIDE    = "/"
+	ASSIGN   = "="
+	PLUS     = "+"
+	MINUS    = "-"
+	REVERSE  = "!"
+	MULTIPLY = "*"
+	DIVIDE   = "/"
+	MODULO   = "%"
+	POWER    = "**"
+	// INTDIVIDE is spelled ~/ because // starts a line comment. It rounds
+	// towards negative infinity, unlike / on integers, which truncates
+	// towards zero: -7 / 2 is -3 but -7 ~/ 2 is -4.
+	INTDIVIDE = "~/"
 	LSHIFT    = "<<"
 	RSHIFT    = ">>"
 	BUMPPLUS  = "++"
 	BUMPMINUS = "--"
 
+	PLUSASSIGN     = "+="
+	MINUSASSIGN    = "-="
+	MULTIPLYASSIGN = "*="
+	DIVIDEASSIGN   = "/="
+	MODULOASSIGN   = "%="
+	LSHIFTASSIGN   = "<<="
+	RSHIFTASSIGN   = ">>="
+
 	LT  = "<"
 	GT  = ">"
 	EQ  = "=="
@@ -51,6 +98,19 @@ const (
 	LE  = "<="
 	GE  = ">="
 
+	AND      = "&&"
+	OR       = "||"
+	COALESCE = "??"
+
+	QUESTION = "?"
+	// SAFEINDEX is spelled ?.[ so that a ternary whose true branch is an
+	// array literal, x ?[1] : 2, still lexes as ? followed by [.
+	SAFEINDEX = "?.["
+
+	BITAND = "&"
+	BITXOR = "^"
+	BITNOT = "~"
+
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
@@ -60,7 +120,10 @@ const (
 	RBRACKET  = "]"
 	LBRACE    = "{"
 	RBRACE    = "}"
-	VERTICAL  = "|"
+	VERTICAL  = "|" // also bitwise or
+	PIPE      = "|>"
+	ARROW     = "=>"
+	ELLIPSIS  = "..."
 
 	FUNCTION = "FUNC"
 	DEFINE   = "LET"
@@ -70,5 +133,11 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	LOOP     = "LOOP"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	MATCH    = "MATCH"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
 	STRING   = "STRING"
 )